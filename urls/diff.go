@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"url.com/data/internal/change"
+	"url.com/data/internal/crawler"
+)
+
+// diffCommand prints what changed between two stored snapshots of a URL:
+//
+//	urls diff [--store sqlite] [--selector main] <url>
+//	urls diff --from 12 --to 40
+func diffCommand(args []string) {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: urls diff [flags] <url>")
+		fmt.Fprintln(fs.Output(), "Compares the last two stored snapshots of a URL, or the snapshots given with --from and --to.")
+		fs.PrintDefaults()
+	}
+	storeFlag := fs.String("store", "postgres", "Where results are stored: postgres, sqlite or file")
+	storePath := fs.String("store-path", "", "SQLite database file or directory of the file store (default urls.db or urls-data)")
+	selector := fs.String("selector", "", "CSS selector of the part of the page compared (default the whole page)")
+	ignoreFlag := fs.String("ignore", "", "Comma-separated regular expressions removed before comparing, e.g. timestamps")
+	fromID := fs.Int64("from", 0, "ID of the older snapshot")
+	toID := fs.Int64("to", 0, "ID of the newer snapshot")
+	fs.Parse(args)
+
+	if (*fromID == 0) != (*toID == 0) {
+		log.Fatalf("--from and --to must be given together")
+	}
+	if *fromID == 0 && fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	storeKind, err := crawler.ParseStoreKind(*storeFlag)
+	if err != nil {
+		log.Fatalf("invalid --store: %v", err)
+	}
+	ignore, err := change.ParseIgnore(strings.Split(*ignoreFlag, ","))
+	if err != nil {
+		log.Fatalf("invalid --ignore: %v", err)
+	}
+
+	store, err := openStore(storeKind, *storePath, crawler.NoCompression, 1)
+	if err != nil {
+		log.Fatalf("failed to open %s store: %v", storeKind, err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	if *fromID == 0 {
+		url := fs.Arg(0)
+		snapshots, err := store.Snapshots(ctx, url, 2)
+		if err != nil {
+			log.Fatalf("failed to look up snapshots of %s: %v", url, err)
+		}
+		if len(snapshots) < 2 {
+			fmt.Printf("%s has %d stored snapshots, nothing to compare\n", url, len(snapshots))
+			return
+		}
+		*fromID, *toID = snapshots[1].ID, snapshots[0].ID
+	}
+
+	c, err := change.Diff(ctx, store, *fromID, *toID, change.Options{Selector: *selector, Ignore: ignore})
+	if err != nil {
+		log.Fatalf("failed to compare snapshots: %v", err)
+	}
+	if !c.Changed() {
+		fmt.Printf("Snapshots %d and %d are identical\n", *fromID, *toID)
+		return
+	}
+	fmt.Print(c.Diff)
+	fmt.Printf("%d lines added, %d removed (%.0f%% changed)\n", c.Added, c.Removed, c.Ratio*100)
+}
@@ -0,0 +1,401 @@
+// Package api serves crawl jobs over HTTP, so that other services can submit
+// URLs and read what was fetched.
+//
+// Endpoints:
+//
+//	POST /jobs                   submit a job, see JobRequest
+//	GET  /jobs/{id}              status and progress of a job
+//	GET  /jobs/{id}/responses    responses fetched by a job
+//	GET  /responses              stored responses, see ResponseFilter
+//	GET  /responses/{id}/body    the body of a stored response
+//	GET  /metrics                Prometheus metrics, see SetMetrics
+//
+// The /responses listings accept the query parameters job, url_prefix,
+// status (a code such as 404, or a class such as 4xx), content_type, since,
+// until (RFC 3339), after (an id, for paging) and limit.
+//
+// Jobs fetch whatever URLs they are given, from wherever the API runs: keep
+// it on an internal address, and require a token with SetToken.
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"url.com/data/internal/crawler"
+	"url.com/data/internal/input"
+	"url.com/data/internal/metrics"
+	"url.com/data/internal/urlnorm"
+)
+
+// maxRequestSize limits the size of a submitted job.
+const maxRequestSize = 10 << 20
+
+// JobRequest is the body of POST /jobs.
+type JobRequest struct {
+	URLs []string `json:"urls"`
+	// Crawl follows links according to the options below; server defaults
+	// apply to the ones left out.
+	Crawl          bool     `json:"crawl"`
+	MaxDepth       *int     `json:"max_depth,omitempty"`
+	MaxPages       *int     `json:"max_pages,omitempty"`
+	AllowedDomains []string `json:"allowed_domains,omitempty"`
+}
+
+// JobStatus is the answer to GET /jobs/{id} and POST /jobs.
+type JobStatus struct {
+	ID        int64                `json:"id"`
+	Status    string               `json:"status"`
+	Crawl     bool                 `json:"crawl"`
+	Options   crawler.CrawlOptions `json:"options"`
+	CreatedAt time.Time            `json:"created_at"`
+	Progress  crawler.Progress     `json:"progress"`
+	Total     int                  `json:"total"`
+	// Invalid lists the submitted URLs that were not queued.
+	Invalid []string `json:"invalid,omitempty"`
+}
+
+// Server runs the jobs submitted over HTTP with a crawler and pool.
+type Server struct {
+	store      *crawler.SQLStore
+	frontier   *crawler.Frontier
+	crawler    *crawler.Crawler
+	pool       *crawler.Pool
+	normalizer *urlnorm.Normalizer
+	defaults   crawler.CrawlOptions
+	metrics    *metrics.Metrics
+	token      string
+
+	// ctx is the lifetime of the jobs, which keep running after the request
+	// that submitted them
+	ctx  context.Context
+	jobs sync.WaitGroup
+}
+
+// New returns a server running jobs until ctx is done. Jobs running at the
+// same time share the workers of pool. Crawl options left out of a
+// JobRequest are taken from defaults.
+func New(ctx context.Context, store *crawler.SQLStore, frontier *crawler.Frontier, c *crawler.Crawler, pool *crawler.Pool,
+	normalizer *urlnorm.Normalizer, defaults crawler.CrawlOptions) *Server {
+	return &Server{
+		store:      store,
+		frontier:   frontier,
+		crawler:    c,
+		pool:       pool,
+		normalizer: normalizer,
+		defaults:   defaults,
+		ctx:        ctx,
+	}
+}
+
+// SetMetrics serves m on /metrics.
+func (s *Server) SetMetrics(m *metrics.Metrics) {
+	s.metrics = m
+}
+
+// SetToken requires requests to send token as a bearer token. Without one,
+// anyone who can reach the API can have the crawler fetch any URL.
+func (s *Server) SetToken(token string) {
+	s.token = token
+}
+
+// Handler returns the HTTP handler of the API.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /jobs", s.submitJob)
+	mux.HandleFunc("GET /jobs/{id}", s.jobStatus)
+	mux.HandleFunc("GET /jobs/{id}/responses", s.listResponses)
+	mux.HandleFunc("GET /responses", s.listResponses)
+	mux.HandleFunc("GET /responses/{id}/body", s.responseBody)
+	if s.metrics != nil {
+		mux.Handle("GET /metrics", s.metrics.Handler())
+	}
+	if s.token == "" {
+		return mux
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, errors.New("missing or invalid bearer token"))
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// ListenAndServe serves the API on addr until the server's context is done,
+// then waits for the running jobs to stop. Their unfinished URLs are released
+// for a later --resume.
+func (s *Server) ListenAndServe(addr string) error {
+	srv := &http.Server{Addr: addr, Handler: s.Handler(), ReadHeaderTimeout: 10 * time.Second}
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- srv.ListenAndServe()
+	}()
+	log.Printf("Serving the API on %s", addr)
+
+	var err error
+	select {
+	case err = <-errs:
+	case <-s.ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		err = srv.Shutdown(shutdownCtx)
+	}
+	s.jobs.Wait()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+func (s *Server) submitJob(w http.ResponseWriter, r *http.Request) {
+	var req JobRequest
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid job: %w", err))
+		return
+	}
+
+	seen := urlnorm.NewSeen(s.normalizer)
+	var urls, invalid []string
+	for _, raw := range req.URLs {
+		canonical, isNew, err := seen.Add(raw)
+		if err == nil {
+			err = input.Validate(canonical)
+		}
+		if err != nil {
+			invalid = append(invalid, raw)
+			continue
+		}
+		if isNew {
+			urls = append(urls, canonical)
+		}
+	}
+	if len(urls) == 0 {
+		writeError(w, http.StatusBadRequest, errors.New("no valid URLs to fetch"))
+		return
+	}
+
+	opts := s.defaults
+	if req.MaxDepth != nil {
+		opts.MaxDepth = *req.MaxDepth
+	}
+	if req.MaxPages != nil {
+		opts.MaxPages = *req.MaxPages
+	}
+	if req.AllowedDomains != nil {
+		opts.AllowedDomains = req.AllowedDomains
+	}
+	if opts.MaxDepth < 0 || opts.MaxPages < 0 {
+		writeError(w, http.StatusBadRequest, errors.New("max_depth and max_pages cannot be negative"))
+		return
+	}
+
+	job, err := s.frontier.CreateJob(r.Context(), req.Crawl, opts, urls)
+	if err != nil {
+		log.Printf("failed to create job: %v", err)
+		writeError(w, http.StatusInternalServerError, errors.New("failed to create job"))
+		return
+	}
+	if err := s.start(job); err != nil {
+		log.Printf("failed to start job %d: %v", job.ID, err)
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("failed to start job %d", job.ID))
+		return
+	}
+	log.Printf("Running job %d with %d URLs", job.ID, len(urls))
+
+	status := JobStatus{
+		ID: job.ID, Status: job.Status, Crawl: job.Crawl, Options: job.Options, CreatedAt: job.CreatedAt,
+		Progress: crawler.Progress{Pending: len(urls)}, Total: len(urls), Invalid: invalid,
+	}
+	w.Header().Set("Location", fmt.Sprintf("/jobs/%d", job.ID))
+	writeJSON(w, http.StatusCreated, status)
+}
+
+// start runs job in the background until it is done or the server stops.
+func (s *Server) start(job *crawler.Job) error {
+	results, err := s.pool.RunJob(s.ctx, s.crawler, s.frontier, job)
+	if err != nil {
+		return err
+	}
+
+	s.jobs.Add(1)
+	go func() {
+		defer s.jobs.Done()
+		failed := 0
+		for result := range results {
+			if result.Err != nil {
+				failed++
+			}
+		}
+		log.Printf("Job %d stopped with %d failed URLs", job.ID, failed)
+	}()
+	return nil
+}
+
+func (s *Server) jobStatus(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusNotFound, errors.New("no such job"))
+		return
+	}
+
+	job, err := s.frontier.LoadJob(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no job %d", id))
+		return
+	}
+	if err != nil {
+		log.Printf("failed to load job %d: %v", id, err)
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("failed to load job %d", id))
+		return
+	}
+	progress, err := s.frontier.Progress(r.Context(), id)
+	if err != nil {
+		log.Printf("failed to count URLs of job %d: %v", id, err)
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("failed to load job %d", id))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, JobStatus{
+		ID: job.ID, Status: job.Status, Crawl: job.Crawl, Options: job.Options, CreatedAt: job.CreatedAt,
+		Progress: progress, Total: progress.Total(),
+	})
+}
+
+func (s *Server) listResponses(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseFilter(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	responses, err := s.store.Responses(r.Context(), filter)
+	if err != nil {
+		log.Printf("failed to list responses: %v", err)
+		writeError(w, http.StatusInternalServerError, errors.New("failed to list responses"))
+		return
+	}
+
+	// Next is the id to pass as after= for the next page, when there may be one
+	page := struct {
+		Responses []crawler.StoredResponse `json:"responses"`
+		Next      int64                    `json:"next,omitempty"`
+	}{Responses: responses}
+	if len(responses) == filter.Limit {
+		page.Next = responses[len(responses)-1].ID
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+// parseFilter reads a ResponseFilter from the query string, and the job from
+// the path of /jobs/{id}/responses.
+func parseFilter(r *http.Request) (crawler.ResponseFilter, error) {
+	q := r.URL.Query()
+	var filter crawler.ResponseFilter
+	var err error
+
+	job := r.PathValue("id")
+	if job == "" {
+		job = q.Get("job")
+	}
+	if job != "" {
+		if filter.JobID, err = strconv.ParseInt(job, 10, 64); err != nil {
+			return filter, fmt.Errorf("invalid job %q", job)
+		}
+	}
+
+	filter.URLPrefix = q.Get("url_prefix")
+	filter.ContentType = q.Get("content_type")
+	if status := strings.ToLower(q.Get("status")); status != "" {
+		if class, ok := strings.CutSuffix(status, "xx"); ok {
+			filter.StatusClass, err = strconv.Atoi(class)
+			if err != nil || filter.StatusClass < 1 || filter.StatusClass > 5 {
+				return filter, fmt.Errorf("invalid status %q", status)
+			}
+		} else if filter.StatusCode, err = strconv.Atoi(status); err != nil {
+			return filter, fmt.Errorf("invalid status %q", status)
+		}
+	}
+	for name, t := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if v := q.Get(name); v != "" {
+			if *t, err = time.Parse(time.RFC3339, v); err != nil {
+				return filter, fmt.Errorf("invalid %s %q: %w", name, v, err)
+			}
+		}
+	}
+	if v := q.Get("after"); v != "" {
+		if filter.AfterID, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return filter, fmt.Errorf("invalid after %q", v)
+		}
+	}
+	filter.Limit = crawler.DefaultResponsesLimit
+	if v := q.Get("limit"); v != "" {
+		if filter.Limit, err = strconv.Atoi(v); err != nil || filter.Limit < 1 {
+			return filter, fmt.Errorf("invalid limit %q", v)
+		}
+		filter.Limit = min(filter.Limit, crawler.MaxResponsesLimit)
+	}
+	return filter, nil
+}
+
+func (s *Server) responseBody(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusNotFound, errors.New("no such response"))
+		return
+	}
+
+	resp, err := s.store.LoadSnapshot(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no response %d", id))
+		return
+	}
+	if err != nil {
+		log.Printf("failed to load response %d: %v", id, err)
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("failed to load response %d", id))
+		return
+	}
+	if resp.Hash == "" {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no body stored for response %d", id))
+		return
+	}
+
+	if resp.ContentType != "" {
+		w.Header().Set("Content-Type", resp.ContentType)
+	} else {
+		w.Header().Set("Content-Type", "application/octet-stream")
+	}
+	// Served as stored, never rendered in the API's origin
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Length", strconv.Itoa(len(resp.Body)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp.Body)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("failed to write response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
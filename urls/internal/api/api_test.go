@@ -0,0 +1,199 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jarcoal/httpmock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"url.com/data/internal/crawler"
+	"url.com/data/internal/urlnorm"
+)
+
+func newTestServer(t *testing.T) (*Server, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	store := crawler.NewPostgresStore(db, crawler.NoCompression)
+	c := crawler.New(store, crawler.Options{IgnoreRobots: true})
+	frontier := crawler.NewFrontier(db, "worker-1", time.Minute)
+	s := New(context.Background(), store, frontier, c, crawler.NewPool(1, 1),
+		urlnorm.New(urlnorm.Options{}), crawler.CrawlOptions{MaxDepth: 2, MaxPages: 100})
+	return s, mock
+}
+
+func serve(s *Server, method, target, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+	return w
+}
+
+func TestSubmitJob(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder("GET", "https://example.com/b", httpmock.NewStringResponder(200, "b"))
+
+	s, mock := newTestServer(t)
+	mock.ExpectQuery(`INSERT INTO crawl_jobs`).
+		WithArgs(crawler.JobRunning, false, `{"MaxDepth":1,"MaxPages":100,"AllowedDomains":null}`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(3, time.Now()))
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO crawl_queue`).
+		WithArgs(int64(3), pq.Array([]string{"https://example.com/b"}), pq.Array([]int64{0}), nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	mock.ExpectQuery(`SELECT url FROM crawl_queue`).WithArgs(int64(3)).
+		WillReturnRows(sqlmock.NewRows([]string{"url"}).AddRow("https://example.com/b"))
+	mock.ExpectExec(`UPDATE crawl_queue SET state`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`UPDATE crawl_queue SET state = \$3, locked_by = \$4`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "url", "depth"}).AddRow(1, "https://example.com/b", 0))
+	mock.ExpectExec(`INSERT INTO url_contents`).WillReturnResult(sqlmock.NewResult(1, 1))
+	// Responses are stored with the job that fetched them
+	mock.ExpectExec(`INSERT INTO url_responses`).
+		WithArgs(jobResponseArgs(3)...).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`UPDATE crawl_queue SET state`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`UPDATE crawl_queue SET state = \$3, locked_by = \$4`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "url", "depth"}))
+	mock.ExpectQuery(`SELECT count\(\*\) FROM crawl_queue`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectExec(`UPDATE crawl_queue SET state`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`UPDATE crawl_jobs SET status`).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	w := serve(s, "POST", "/jobs", `{"urls": ["https://example.com/b", "HTTPS://example.com/b#top", "not a url"], "max_depth": 1}`)
+	s.jobs.Wait()
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "/jobs/3", w.Header().Get("Location"))
+	var status JobStatus
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+	assert.Equal(t, int64(3), status.ID)
+	assert.Equal(t, 1, status.Total)
+	assert.Equal(t, []string{"not a url"}, status.Invalid)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	w = serve(s, "POST", "/jobs", `{"urls": ["not a url"]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = serve(s, "POST", "/jobs", `{"urls": ["https://example.com/"], "depth": 1}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+// jobResponseArgs matches the arguments of a response stored by job.
+func jobResponseArgs(job int64) []driver.Value {
+	args := make([]driver.Value, 24, 25)
+	for i := range args {
+		args[i] = sqlmock.AnyArg()
+	}
+	return append(args, job)
+}
+
+func TestToken(t *testing.T) {
+	s, mock := newTestServer(t)
+	s.SetToken("s3cret")
+	mock.ExpectQuery(`SELECT id, status, crawl`).WithArgs(int64(4)).WillReturnError(sql.ErrNoRows)
+
+	for _, header := range []string{"", "Bearer wrong", "s3cret", "Basic czNjcmV0"} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/jobs/4", nil)
+		req.Header.Set("Authorization", header)
+		s.Handler().ServeHTTP(w, req)
+		assert.Equal(t, http.StatusUnauthorized, w.Code, header)
+	}
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/jobs/4", nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	s.Handler().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestJobStatus(t *testing.T) {
+	s, mock := newTestServer(t)
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`SELECT id, status, crawl`).WithArgs(int64(3)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status", "crawl", "options", "created_at"}).
+			AddRow(3, crawler.JobRunning, true, `{"MaxDepth":1,"MaxPages":10}`, created))
+	mock.ExpectQuery(`SELECT state, count\(\*\) FROM crawl_queue`).WithArgs(int64(3)).
+		WillReturnRows(sqlmock.NewRows([]string{"state", "count"}).
+			AddRow(crawler.StatePending, 4).AddRow(crawler.StateDone, 5).AddRow(crawler.StateFailed, 1))
+	mock.ExpectQuery(`SELECT id, status, crawl`).WithArgs(int64(4)).
+		WillReturnError(sql.ErrNoRows)
+
+	w := serve(s, "GET", "/jobs/3", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var status JobStatus
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+	assert.Equal(t, JobStatus{
+		ID: 3, Status: crawler.JobRunning, Crawl: true, Options: crawler.CrawlOptions{MaxDepth: 1, MaxPages: 10},
+		CreatedAt: created, Progress: crawler.Progress{Pending: 4, Done: 5, Failed: 1}, Total: 10,
+	}, status)
+
+	assert.Equal(t, http.StatusNotFound, serve(s, "GET", "/jobs/4", "").Code)
+	assert.Equal(t, http.StatusNotFound, serve(s, "GET", "/jobs/x", "").Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestListResponses(t *testing.T) {
+	s, mock := newTestServer(t)
+	columns := []string{"id", "job_id", "url", "final_url", "status_code", "content_type", "content_length",
+		"content_hash", "fetch_duration_ms", "fetched_at", "unchanged_from", "truncated", "title"}
+	fetched := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`FROM url_responses\s+WHERE job_id = \$1 AND substr\(url, 1, \$2\) = \$3 AND status_code BETWEEN \$4 AND \$5 AND id > \$6\s+ORDER BY id\s+LIMIT \$7`).
+		WithArgs(int64(3), 20, "https://example.com/", 400, 499, int64(10), 2).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(11, 3, "https://example.com/a", "https://example.com/a", 404, "text/html", 9, "h1", 12, fetched, 0, false, "").
+			AddRow(12, 3, "https://example.com/b", "https://example.com/b", 410, "text/html", 4, "h2", 8, fetched, 0, false, "Gone"))
+
+	w := serve(s, "GET", "/jobs/3/responses?url_prefix=https://example.com/&status=4xx&after=10&limit=2", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var page struct {
+		Responses []crawler.StoredResponse
+		Next      int64
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	assert.Len(t, page.Responses, 2)
+	assert.Equal(t, "Gone", page.Responses[1].Title)
+	assert.Equal(t, int64(12), page.Next)
+
+	for _, query := range []string{"status=abc", "status=9xx", "since=yesterday", "limit=0", "job=x"} {
+		assert.Equal(t, http.StatusBadRequest, serve(s, "GET", "/responses?"+query, "").Code, query)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestResponseBody(t *testing.T) {
+	s, mock := newTestServer(t)
+	snapshotColumns := []string{"url", "final_url", "status_code", "content_type", "unchanged_from", "hash", "encoding", "data", "charset", "text"}
+	mock.ExpectQuery(`FROM url_responses r`).WithArgs(int64(7)).
+		WillReturnRows(sqlmock.NewRows(snapshotColumns).
+			AddRow("https://example.com/", "https://example.com/", 200, "text/html; charset=utf-8", nil, "h1", "identity", []byte("<p>hi</p>"), "utf-8", "<p>hi</p>"))
+	mock.ExpectQuery(`FROM url_responses r`).WithArgs(int64(8)).WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery(`FROM url_responses r`).WithArgs(int64(9)).
+		WillReturnRows(sqlmock.NewRows(snapshotColumns).
+			AddRow("https://example.com/down", "https://example.com/down", 0, "", nil, "", "", nil, "", ""))
+
+	w := serve(s, "GET", "/responses/7/body", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, "sandbox", w.Header().Get("Content-Security-Policy"))
+	assert.Equal(t, "<p>hi</p>", w.Body.String())
+
+	assert.Equal(t, http.StatusNotFound, serve(s, "GET", "/responses/8/body", "").Code)
+	// Nothing to serve for responses stored without a body
+	assert.Equal(t, http.StatusNotFound, serve(s, "GET", "/responses/9/body", "").Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
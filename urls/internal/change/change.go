@@ -0,0 +1,187 @@
+package change
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/andybalholm/cascadia"
+	"github.com/pmezard/go-difflib/difflib"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Options controls which part of a page is compared.
+type Options struct {
+	// Selector limits the comparison to the elements matching this CSS
+	// selector, e.g. "main" or "#content".
+	Selector string
+	// Ignore patterns are removed from the text before comparing, e.g.
+	// timestamps or visitor counters.
+	Ignore []*regexp.Regexp
+}
+
+// ParseIgnore compiles the ignore patterns given on the command line.
+func ParseIgnore(patterns []string) ([]*regexp.Regexp, error) {
+	var ignore []*regexp.Regexp
+	for _, p := range patterns {
+		if p = strings.TrimSpace(p); p == "" {
+			continue
+		}
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ignore pattern %q: %w", p, err)
+		}
+		ignore = append(ignore, re)
+	}
+	return ignore, nil
+}
+
+// boilerplate elements never hold the content of a page.
+var boilerplate = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Template: true, atom.Svg: true,
+	atom.Head: true, atom.Nav: true, atom.Header: true, atom.Footer: true, atom.Aside: true,
+	atom.Iframe: true, atom.Form: true,
+}
+
+// blocks start a new line of text.
+var blocks = map[atom.Atom]bool{
+	atom.P: true, atom.Div: true, atom.Br: true, atom.Li: true, atom.Tr: true, atom.Td: true, atom.Th: true,
+	atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+	atom.Section: true, atom.Article: true, atom.Main: true, atom.Pre: true, atom.Blockquote: true,
+	atom.Dt: true, atom.Dd: true, atom.Table: true, atom.Ul: true, atom.Ol: true, atom.Hr: true,
+}
+
+// Text returns the text of an HTML page to compare, one block per line,
+// without scripts, styles, navigation and other boilerplate. Other content
+// types are compared as they are.
+func Text(body []byte, isHTML bool, opts Options) (string, error) {
+	text := string(body)
+	if isHTML {
+		var err error
+		if text, err = htmlText(body, opts.Selector); err != nil {
+			return "", err
+		}
+	}
+
+	for _, re := range opts.Ignore {
+		text = re.ReplaceAllString(text, "")
+	}
+
+	// Collapse blanks so that reformatting alone is not a change
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+func htmlText(body []byte, selector string) (string, error) {
+	doc, err := html.Parse(bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+
+	roots := []*html.Node{doc}
+	if selector != "" {
+		sel, err := cascadia.Parse(selector)
+		if err != nil {
+			return "", fmt.Errorf("invalid selector %q: %w", selector, err)
+		}
+		roots = cascadia.QueryAll(doc, sel)
+	}
+
+	var b strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		switch n.Type {
+		case html.TextNode:
+			b.WriteString(n.Data)
+			return
+		case html.CommentNode:
+			return
+		case html.ElementNode:
+			if boilerplate[n.DataAtom] {
+				return
+			}
+			if blocks[n.DataAtom] {
+				b.WriteByte('\n')
+				defer b.WriteByte('\n')
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	for _, root := range roots {
+		walk(root)
+		b.WriteByte('\n')
+	}
+	return b.String(), nil
+}
+
+// Change is the difference between the texts of two snapshots.
+type Change struct {
+	// Added and Removed count changed lines.
+	Added   int
+	Removed int
+	// Ratio is the share of lines that changed, from 0 (identical) to 1.
+	Ratio float64
+	// Diff is a unified diff of the two texts.
+	Diff string
+}
+
+// Changed reports whether any line changed.
+func (c Change) Changed() bool {
+	return c.Added > 0 || c.Removed > 0
+}
+
+// Material reports whether at least threshold of the lines changed. Any
+// change is material with a threshold of 0.
+func (c Change) Material(threshold float64) bool {
+	return c.Changed() && c.Ratio >= threshold
+}
+
+// Compare diffs the texts of two snapshots, labelled from and to in the
+// unified diff.
+func Compare(old, new, from, to string) (Change, error) {
+	a, b := splitLines(old), splitLines(new)
+
+	var c Change
+	for _, op := range difflib.NewMatcher(a, b).GetOpCodes() {
+		switch op.Tag {
+		case 'd':
+			c.Removed += op.I2 - op.I1
+		case 'i':
+			c.Added += op.J2 - op.J1
+		case 'r':
+			c.Removed += op.I2 - op.I1
+			c.Added += op.J2 - op.J1
+		}
+	}
+	if total := len(a) + len(b); total > 0 {
+		c.Ratio = float64(c.Added+c.Removed) / float64(total)
+	}
+	if !c.Changed() {
+		return c, nil
+	}
+
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{A: a, B: b, FromFile: from, ToFile: to, Context: 3})
+	if err != nil {
+		return c, err
+	}
+	c.Diff = diff
+	return c, nil
+}
+
+// splitLines splits text into lines that keep their newline, as difflib
+// expects.
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return difflib.SplitLines(text)
+}
@@ -0,0 +1,115 @@
+package change
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"url.com/data/internal/crawler"
+)
+
+const page = `<html><head><title>Prices</title><style>p { color: red }</style></head>
+<body>
+  <nav><a href="/">Home</a></nav>
+  <main>
+    <h1>Prices</h1>
+    <p>Basic:   10 EUR</p>
+    <p>Pro: 20 EUR</p>
+  </main>
+  <div id="clock">Rendered at 12:00:01</div>
+  <script>track()</script>
+  <footer>Copyright</footer>
+</body></html>`
+
+func TestText(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     Options
+		expected string
+	}{
+		{
+			name:     "Boilerplate stripped",
+			expected: "Prices\nBasic: 10 EUR\nPro: 20 EUR\nRendered at 12:00:01",
+		},
+		{
+			name:     "Selector",
+			opts:     Options{Selector: "main p"},
+			expected: "Basic: 10 EUR\nPro: 20 EUR",
+		},
+		{
+			name:     "Ignore patterns",
+			opts:     Options{Ignore: []*regexp.Regexp{regexp.MustCompile(`Rendered at [0-9:]+`)}},
+			expected: "Prices\nBasic: 10 EUR\nPro: 20 EUR",
+		},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			text, err := Text([]byte(page), true, testCase.opts)
+			assert.NoError(t, err)
+			assert.Equal(t, testCase.expected, text)
+		})
+	}
+}
+
+func TestCompare(t *testing.T) {
+	c, err := Compare("a\nb\nc\nd", "a\nB\nc\nd", "old", "new")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, c.Added)
+	assert.Equal(t, 1, c.Removed)
+	assert.Equal(t, 0.25, c.Ratio)
+	assert.Contains(t, c.Diff, "--- old\n+++ new\n")
+	assert.Contains(t, c.Diff, "-b\n+B\n")
+	assert.True(t, c.Material(0.2))
+	assert.False(t, c.Material(0.5))
+
+	c, err = Compare("a\nb", "a\nb", "old", "new")
+	assert.NoError(t, err)
+	assert.False(t, c.Changed())
+	assert.Empty(t, c.Diff)
+}
+
+func TestMonitor(t *testing.T) {
+	var events []Event
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e Event
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&e))
+		events = append(events, e)
+	}))
+	defer webhook.Close()
+
+	store, err := crawler.OpenFileStore(t.TempDir(), crawler.NoCompression)
+	require.NoError(t, err)
+	defer store.Close()
+
+	// Each visit stores the next body, as a fetch would
+	bodies := []string{page, page, strings.Replace(page, "</main>", "<p>Enterprise: 50 EUR</p></main>", 1)}
+	visits := 0
+	visit := func(ctx context.Context, url string) crawler.Result {
+		body := bodies[visits]
+		visits++
+		err := store.SaveResponse(ctx, &crawler.Response{
+			URL: url, FinalURL: url, StatusCode: 200, ContentType: "text/html", FetchedAt: time.Now(),
+			Body: []byte(body), ContentLength: int64(len(body)),
+		})
+		return crawler.Result{URL: url, Err: err}
+	}
+
+	wrapped := NewMonitor(store, Options{Selector: "main"}, 0, webhook.URL).Wrap(visit)
+	for range bodies {
+		assert.NoError(t, wrapped(context.Background(), "https://example.com/prices").Err)
+	}
+
+	require.Len(t, events, 1)
+	assert.Equal(t, int64(2), events[0].PreviousID)
+	assert.Equal(t, int64(3), events[0].CurrentID)
+	assert.Equal(t, 1, events[0].Added)
+	assert.Contains(t, events[0].Diff, "+Enterprise: 50 EUR")
+}
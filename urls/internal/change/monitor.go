@@ -0,0 +1,149 @@
+package change
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"url.com/data/internal/crawler"
+)
+
+// Diff compares two stored snapshots by id.
+func Diff(ctx context.Context, store crawler.ResultStore, fromID, toID int64, opts Options) (Change, error) {
+	from, err := snapshotText(ctx, store, fromID, opts)
+	if err != nil {
+		return Change{}, err
+	}
+	to, err := snapshotText(ctx, store, toID, opts)
+	if err != nil {
+		return Change{}, err
+	}
+	return Compare(from, to, fmt.Sprintf("snapshot %d", fromID), fmt.Sprintf("snapshot %d", toID))
+}
+
+func snapshotText(ctx context.Context, store crawler.ResultStore, id int64, opts Options) (string, error) {
+	resp, err := store.LoadSnapshot(ctx, id)
+	if err != nil {
+		return "", fmt.Errorf("failed to load snapshot %d: %w", id, err)
+	}
+	return Text(resp.HTML(), resp.IsHTML(), opts)
+}
+
+// Event is posted to the webhook when a page changed materially.
+type Event struct {
+	URL               string    `json:"url"`
+	PreviousID        int64     `json:"previous_id"`
+	CurrentID         int64     `json:"current_id"`
+	PreviousFetchedAt time.Time `json:"previous_fetched_at"`
+	FetchedAt         time.Time `json:"fetched_at"`
+	Added             int       `json:"added"`
+	Removed           int       `json:"removed"`
+	Ratio             float64   `json:"ratio"`
+	Diff              string    `json:"diff"`
+}
+
+// Monitor compares each new snapshot of a URL with the one before it.
+type Monitor struct {
+	store     crawler.ResultStore
+	opts      Options
+	threshold float64
+	webhook   string
+	client    *http.Client
+}
+
+// NewMonitor returns a monitor comparing the snapshots in store. Changes of
+// at least threshold of the lines are logged and, when webhook is set,
+// posted to it as an Event.
+func NewMonitor(store crawler.ResultStore, opts Options, threshold float64, webhook string) *Monitor {
+	return &Monitor{
+		store:     store,
+		opts:      opts,
+		threshold: threshold,
+		webhook:   webhook,
+		client:    &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Wrap returns visit with every successful fetch compared to the snapshot
+// stored before it. Comparing never fails the fetch; problems are logged.
+func (m *Monitor) Wrap(visit func(ctx context.Context, url string) crawler.Result) func(ctx context.Context, url string) crawler.Result {
+	return func(ctx context.Context, url string) crawler.Result {
+		before, err := m.store.Snapshots(ctx, url, 1)
+		if err != nil {
+			log.Printf("failed to look up previous snapshot of %s: %v", url, err)
+		}
+		result := visit(ctx, url)
+		if result.Err != nil || len(before) == 0 {
+			return result
+		}
+
+		if err := m.check(ctx, url, before[0]); err != nil {
+			log.Printf("failed to compare snapshots of %s: %v", url, err)
+		}
+		return result
+	}
+}
+
+// check compares the latest snapshot of url with previous.
+func (m *Monitor) check(ctx context.Context, url string, previous crawler.Snapshot) error {
+	after, err := m.store.Snapshots(ctx, url, 1)
+	if err != nil {
+		return err
+	}
+	if len(after) == 0 || after[0].ID == previous.ID || after[0].ContentHash == previous.ContentHash {
+		// Revalidated, not stored, or downloaded again unchanged
+		return nil
+	}
+	current := after[0]
+
+	change, err := Diff(ctx, m.store, previous.ID, current.ID, m.opts)
+	if err != nil {
+		return err
+	}
+	if !change.Material(m.threshold) {
+		return nil
+	}
+
+	log.Printf("%s changed: %d lines added, %d removed (snapshot %d to %d)", url, change.Added, change.Removed, previous.ID, current.ID)
+	if m.webhook == "" {
+		return nil
+	}
+	return m.notify(ctx, Event{
+		URL:               url,
+		PreviousID:        previous.ID,
+		CurrentID:         current.ID,
+		PreviousFetchedAt: previous.FetchedAt,
+		FetchedAt:         current.FetchedAt,
+		Added:             change.Added,
+		Removed:           change.Removed,
+		Ratio:             change.Ratio,
+		Diff:              change.Diff,
+	})
+}
+
+// notify posts event to the webhook as JSON.
+func (m *Monitor) notify(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.webhook, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
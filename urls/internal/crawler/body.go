@@ -0,0 +1,116 @@
+package crawler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"strings"
+)
+
+var (
+	// ErrBodyTooLarge is returned for bodies over Options.MaxBodySize unless
+	// Options.TruncateBody is set.
+	ErrBodyTooLarge = errors.New("response body exceeds maximum size")
+	// ErrContentType is returned for responses whose content type is not in
+	// Options.ContentTypes.
+	ErrContentType = errors.New("content type not allowed")
+)
+
+// maxInMemoryBody is the largest body kept in memory. Bigger bodies are
+// spooled to a temporary file and streamed to storage in chunks.
+const maxInMemoryBody = 8 << 20
+
+// readBody reads the response body into resp, up to limit bytes when limit is
+// positive. Bodies over the limit are truncated when truncate is set and
+// rejected with ErrBodyTooLarge otherwise. The caller must Close resp.
+func (resp *Response) readBody(r io.Reader, limit int64, truncate bool) error {
+	src := r
+	if limit > 0 {
+		src = io.LimitReader(r, limit)
+	}
+	hash := sha256.New()
+	src = io.TeeReader(src, hash)
+
+	var buf bytes.Buffer
+	n, err := io.CopyN(&buf, src, maxInMemoryBody+1)
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	if n > maxInMemoryBody {
+		if resp.spool, err = os.CreateTemp("", "urls-body-*"); err != nil {
+			return err
+		}
+		if _, err := buf.WriteTo(resp.spool); err != nil {
+			return err
+		}
+		m, err := io.Copy(resp.spool, src)
+		if err != nil {
+			return err
+		}
+		n += m
+	} else {
+		resp.Body = buf.Bytes()
+	}
+
+	if limit > 0 && n == limit {
+		// Anything left past the limit means the body was cut short
+		var next [1]byte
+		if k, _ := io.ReadFull(r, next[:]); k > 0 {
+			if !truncate {
+				return ErrBodyTooLarge
+			}
+			resp.Truncated = true
+		}
+	}
+
+	resp.ContentLength = n
+	resp.Hash = hex.EncodeToString(hash.Sum(nil))
+	return nil
+}
+
+// open returns a reader over the whole body, wherever it is kept.
+func (resp *Response) open() (io.Reader, error) {
+	if resp.spool == nil {
+		return bytes.NewReader(resp.Body), nil
+	}
+	if _, err := resp.spool.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return resp.spool, nil
+}
+
+// Close removes the temporary file a large body was spooled to.
+func (resp *Response) Close() error {
+	if resp == nil || resp.spool == nil {
+		return nil
+	}
+	name := resp.spool.Name()
+	err := resp.spool.Close()
+	resp.spool = nil
+	if removeErr := os.Remove(name); err == nil {
+		err = removeErr
+	}
+	return err
+}
+
+// contentTypeAllowed reports whether mediaType matches one of allowed, which
+// may contain wildcards such as "text/*". An empty list allows everything.
+func contentTypeAllowed(mediaType string, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, a := range allowed {
+		a = strings.ToLower(strings.TrimSpace(a))
+		if a == mediaType || a == "*/*" {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(a, "/*"); ok && strings.HasPrefix(mediaType, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,140 @@
+package crawler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadBodyLimit(t *testing.T) {
+	tests := []struct {
+		name              string
+		body              string
+		limit             int64
+		truncate          bool
+		expectedErr       error
+		expectedBody      string
+		expectedTruncated bool
+	}{
+		{name: "No limit", body: "hello world", expectedBody: "hello world"},
+		{name: "Under limit", body: "hello", limit: 5, expectedBody: "hello"},
+		{name: "Over limit rejected", body: "hello world", limit: 5, expectedErr: ErrBodyTooLarge},
+		{name: "Over limit truncated", body: "hello world", limit: 5, truncate: true, expectedBody: "hello", expectedTruncated: true},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			resp := &Response{}
+			defer resp.Close()
+
+			err := resp.readBody(strings.NewReader(testCase.body), testCase.limit, testCase.truncate)
+
+			assert.Equal(t, testCase.expectedErr, err)
+			if err == nil {
+				assert.Equal(t, testCase.expectedBody, string(resp.Body))
+				assert.Equal(t, int64(len(testCase.expectedBody)), resp.ContentLength)
+				assert.Equal(t, ContentHash([]byte(testCase.expectedBody)), resp.Hash)
+				assert.Equal(t, testCase.expectedTruncated, resp.Truncated)
+			}
+		})
+	}
+}
+
+func TestFetchURLMaxBodySize(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	var compressed bytes.Buffer
+	w := gzip.NewWriter(&compressed)
+	w.Write([]byte("hello"))
+	w.Close()
+	gzipped := httpmock.NewBytesResponse(200, compressed.Bytes())
+	gzipped.Header.Set("Content-Encoding", "gzip")
+	gzipped.ContentLength = int64(compressed.Len())
+	httpmock.RegisterResponder("GET", "https://example.com/gzip", httpmock.ResponderFromResponse(gzipped))
+	plain := httpmock.NewStringResponse(200, "hello world")
+	plain.ContentLength = 11
+	httpmock.RegisterResponder("GET", "https://example.com/plain", httpmock.ResponderFromResponse(plain))
+
+	c := New(nil, Options{IgnoreRobots: true, MaxBodySize: 10})
+
+	// The limit applies to the decoded body, not to the compressed length
+	resp, err := c.FetchURL(context.Background(), "https://example.com/gzip")
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(resp.Body))
+
+	_, err = c.FetchURL(context.Background(), "https://example.com/plain")
+	assert.ErrorIs(t, err, ErrBodyTooLarge)
+}
+
+func TestReadBodySpool(t *testing.T) {
+	body := bytes.Repeat([]byte("0123456789abcdef"), (maxInMemoryBody/16)+1)
+
+	resp := &Response{}
+	assert.NoError(t, resp.readBody(bytes.NewReader(body), 0, false))
+	assert.Nil(t, resp.Body)
+	assert.NotNil(t, resp.spool)
+	assert.Equal(t, int64(len(body)), resp.ContentLength)
+	assert.Equal(t, ContentHash(body), resp.Hash)
+
+	r, err := resp.open()
+	assert.NoError(t, err)
+	spooled, err := io.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Equal(t, body, spooled)
+
+	// Streamed to the database in chunks
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO url_contents`).
+		WithArgs(resp.Hash, "identity", int64(len(body))).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	for seq := 0; seq*contentChunkSize < len(body); seq++ {
+		mock.ExpectExec(`INSERT INTO url_content_chunks`).
+			WithArgs(resp.Hash, seq, sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+	}
+	mock.ExpectCommit()
+
+	hash, err := NewPostgresStore(db, NoCompression).saveContent(context.Background(), resp)
+	assert.NoError(t, err)
+	assert.Equal(t, resp.Hash, hash)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unmet expectations: %v", err)
+	}
+
+	name := resp.spool.Name()
+	assert.NoError(t, resp.Close())
+	assert.NoFileExists(t, name)
+}
+
+func TestFetchURLContentTypes(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder("GET", "https://example.com/page",
+		httpmock.NewStringResponder(200, "<html></html>").HeaderSet(map[string][]string{"Content-Type": {"text/html; charset=utf-8"}}))
+	httpmock.RegisterResponder("GET", "https://example.com/image",
+		httpmock.NewBytesResponder(200, []byte("\x89PNG\r\n\x1a\n")))
+
+	c := New(nil, Options{IgnoreRobots: true, ContentTypes: []string{"text/*", "application/json"}})
+
+	resp, err := c.FetchURL(context.Background(), "https://example.com/page")
+	assert.NoError(t, err)
+	assert.Equal(t, "text/html", resp.MediaType())
+
+	// Sniffed when the server sends no Content-Type
+	_, err = c.FetchURL(context.Background(), "https://example.com/image")
+	assert.Equal(t, Policy, KindOf(err))
+	assert.ErrorIs(t, err, ErrContentType)
+}
@@ -0,0 +1,110 @@
+package crawler
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/andybalholm/brotli"
+	"golang.org/x/net/html/charset"
+	"golang.org/x/text/encoding"
+)
+
+// acceptEncoding is sent with every request; bodies are decoded by
+// decodeContentEncoding since setting it disables Go's transparent gzip.
+const acceptEncoding = "gzip, deflate, br"
+
+// decodeContentEncoding undoes the Content-Encoding of a response body, which
+// lists the codings in the order they were applied.
+func decodeContentEncoding(header string, body io.Reader) (io.Reader, error) {
+	codings := strings.Split(header, ",")
+	peeked := false
+	for i := len(codings) - 1; i >= 0; i-- {
+		coding := strings.ToLower(strings.TrimSpace(codings[i]))
+		if coding == "" || coding == "identity" {
+			continue
+		}
+		if !peeked {
+			// Empty bodies, e.g. of 304 responses, are often sent with the
+			// Content-Encoding of the full response
+			br := bufio.NewReader(body)
+			if _, err := br.Peek(1); err == io.EOF {
+				return br, nil
+			}
+			body, peeked = br, true
+		}
+		switch coding {
+		case "gzip", "x-gzip":
+			r, err := gzip.NewReader(body)
+			if err != nil {
+				return nil, err
+			}
+			body = r
+		case "deflate":
+			body = inflate(body)
+		case "br":
+			body = brotli.NewReader(body)
+		default:
+			return nil, fmt.Errorf("unsupported content encoding %q", coding)
+		}
+	}
+	return body, nil
+}
+
+// inflate decodes "deflate" bodies, which are meant to be zlib streams but
+// are sent as raw deflate by some servers.
+func inflate(body io.Reader) io.Reader {
+	br := bufio.NewReader(body)
+	header, err := br.Peek(2)
+	if err == nil && header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+		if r, err := zlib.NewReader(br); err == nil {
+			return r
+		}
+	}
+	return flate.NewReader(br)
+}
+
+// isText reports whether bodies of mediaType should be decoded to text.
+func isText(mediaType string) bool {
+	if strings.HasPrefix(mediaType, "text/") {
+		return true
+	}
+	switch mediaType {
+	case "application/json", "application/xml", "application/javascript", "application/ecmascript",
+		"application/xhtml+xml", "application/rss+xml", "application/atom+xml", "image/svg+xml":
+		return true
+	}
+	return strings.HasSuffix(mediaType, "+json") || strings.HasSuffix(mediaType, "+xml")
+}
+
+// decodeText sets Text to the body decoded to UTF-8, using the charset from
+// the Content-Type header, a byte order mark or an HTML meta tag. Binary and
+// spooled bodies are left without text.
+func (resp *Response) decodeText() {
+	if resp.Body == nil || !isText(resp.MediaType()) {
+		return
+	}
+
+	enc, name, certain := charset.DetermineEncoding(resp.Body, resp.ContentType)
+	if !certain && name == "windows-1252" && utf8.Valid(resp.Body) {
+		// The HTML fallback guess; valid UTF-8 is far more likely today
+		enc, name = encoding.Nop, "utf-8"
+	}
+	text, err := enc.NewDecoder().Bytes(resp.Body)
+	if err != nil {
+		text, name = resp.Body, "utf-8"
+	}
+
+	// Postgres rejects NUL bytes and invalid UTF-8 in TEXT columns
+	s := strings.ReplaceAll(string(text), "\x00", "")
+	if !utf8.ValidString(s) {
+		s = strings.ToValidUTF8(s, "�")
+	}
+	resp.Text = s
+	resp.Charset = name
+}
@@ -0,0 +1,96 @@
+package crawler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeText(t *testing.T) {
+	tests := []struct {
+		name            string
+		contentType     string
+		body            []byte
+		expectedText    string
+		expectedCharset string
+	}{
+		{
+			name:            "Charset from header",
+			contentType:     "text/plain; charset=iso-8859-1",
+			body:            []byte("caf\xe9"),
+			expectedText:    "café",
+			expectedCharset: "windows-1252",
+		},
+		{
+			name:            "Charset from meta tag",
+			contentType:     "text/html",
+			body:            []byte(`<html><head><meta charset="shift_jis"></head><body>` + "\x93\xfa\x96\x7b" + `</body></html>`),
+			expectedText:    `<html><head><meta charset="shift_jis"></head><body>日本</body></html>`,
+			expectedCharset: "shift_jis",
+		},
+		{
+			name:            "NUL bytes removed",
+			contentType:     "application/json",
+			body:            []byte("{\"a\":\"b\x00\"}"),
+			expectedText:    `{"a":"b"}`,
+			expectedCharset: "utf-8",
+		},
+		{
+			name:        "Binary content has no text",
+			contentType: "image/png",
+			body:        []byte("\x89PNG\r\n\x1a\n\x00\x00"),
+		},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			resp := &Response{ContentType: testCase.contentType, Body: testCase.body}
+			resp.decodeText()
+
+			assert.Equal(t, testCase.expectedText, resp.Text)
+			assert.Equal(t, testCase.expectedCharset, resp.Charset)
+		})
+	}
+}
+
+func TestFetchURLContentEncoding(t *testing.T) {
+	const page = "<html><body>compressed</body></html>"
+
+	var gzipped bytes.Buffer
+	gw := gzip.NewWriter(&gzipped)
+	gw.Write([]byte(page))
+	gw.Close()
+
+	var brotlied bytes.Buffer
+	bw := brotli.NewWriter(&brotlied)
+	bw.Write([]byte(page))
+	bw.Close()
+
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	for path, body := range map[string][]byte{"gzip": gzipped.Bytes(), "br": brotlied.Bytes()} {
+		encoding := path
+		httpmock.RegisterResponder("GET", "https://example.com/"+path, func(req *http.Request) (*http.Response, error) {
+			assert.Equal(t, acceptEncoding, req.Header.Get("Accept-Encoding"))
+			resp := httpmock.NewBytesResponse(200, body)
+			resp.Header.Set("Content-Encoding", encoding)
+			resp.Header.Set("Content-Type", "text/html")
+			return resp, nil
+		})
+	}
+
+	c := New(nil, Options{IgnoreRobots: true})
+	for _, path := range []string{"gzip", "br"} {
+		resp, err := c.FetchURL(context.Background(), "https://example.com/"+path)
+		if assert.NoError(t, err) {
+			assert.Equal(t, page, string(resp.Body))
+			assert.Equal(t, page, resp.Text)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package crawler
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// DefaultTimeout bounds a single request when ClientOptions.Timeout is 0.
+const DefaultTimeout = 30 * time.Second
+
+// ClientOptions configures the HTTP client of a Crawler.
+type ClientOptions struct {
+	// Timeout bounds a single request, including reading its body.
+	Timeout time.Duration
+	// Headers are sent with every request that does not set them itself.
+	// Requests always set User-Agent, from Options.UserAgent.
+	Headers http.Header
+	// Proxy is the http, https or socks5 proxy requests go through. When
+	// nil the HTTP_PROXY, HTTPS_PROXY and NO_PROXY variables apply.
+	Proxy *url.URL
+	// Cookies keeps the cookies set by servers for the rest of the run, or
+	// of the job when running one. They are only kept in memory: a resumed
+	// job, or another process working on it, starts without them.
+	Cookies bool
+	// Auth holds the credentials sent to hosts; the first entry matching
+	// the host of a request applies.
+	Auth []HostAuth
+	// TLS configures certificate verification and client certificates.
+	TLS TLSOptions
+}
+
+// HostAuth holds the credentials of a host. An auth file is a JSON array of
+// them:
+//
+//	[
+//	  {"host": "docs.example.com", "username": "crawler", "password_env": "DOCS_PASSWORD"},
+//	  {"host": "*.api.example.com", "token_env": "API_TOKEN"},
+//	  {"host": "wiki.example.com:8443", "headers": {"X-Api-Key": "..."}}
+//	]
+//
+// Secrets can be given inline with password and token, or read from the
+// environment with password_env and token_env.
+type HostAuth struct {
+	// Host matches the host of a request, and its port if it has one. A
+	// leading "*." matches any subdomain.
+	Host        string            `json:"host"`
+	Username    string            `json:"username,omitempty"`
+	Password    string            `json:"password,omitempty"`
+	PasswordEnv string            `json:"password_env,omitempty"`
+	Token       string            `json:"token,omitempty"`
+	TokenEnv    string            `json:"token_env,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty"`
+}
+
+// LoadAuth reads an auth file and resolves the secrets it takes from the
+// environment.
+func LoadAuth(path string) ([]HostAuth, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var auth []HostAuth
+	if err := json.Unmarshal(data, &auth); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	for i := range auth {
+		a := &auth[i]
+		a.Host = strings.ToLower(strings.TrimSpace(a.Host))
+		if a.Host == "" {
+			return nil, fmt.Errorf("entry %d: missing host", i+1)
+		}
+		for _, secret := range []struct {
+			value *string
+			env   string
+		}{{&a.Password, a.PasswordEnv}, {&a.Token, a.TokenEnv}} {
+			if secret.env == "" {
+				continue
+			}
+			v, ok := os.LookupEnv(secret.env)
+			if !ok {
+				return nil, fmt.Errorf("entry %d (%s): environment variable %s is not set", i+1, a.Host, secret.env)
+			}
+			*secret.value = v
+		}
+		if a.Token != "" && a.Username != "" {
+			return nil, fmt.Errorf("entry %d (%s): a host has either a username or a token", i+1, a.Host)
+		}
+	}
+	return auth, nil
+}
+
+// hostMatches reports whether the lower-cased pattern matches the host of
+// u, and its port when pattern has one. A leading "*." matches any
+// subdomain.
+func hostMatches(pattern string, u *url.URL) bool {
+	host := strings.ToLower(u.Hostname())
+	if strings.Contains(pattern, ":") {
+		host = strings.ToLower(u.Host)
+	}
+	if suffix, ok := strings.CutPrefix(pattern, "*"); ok {
+		return strings.HasSuffix(host, suffix)
+	}
+	return host == pattern
+}
+
+// apply sets the credentials of a on req.
+func (a *HostAuth) apply(req *http.Request) {
+	switch {
+	case a.Username != "":
+		req.SetBasicAuth(a.Username, a.Password)
+	case a.Token != "":
+		req.Header.Set("Authorization", "Bearer "+a.Token)
+	}
+	for name, value := range a.Headers {
+		req.Header.Set(name, value)
+	}
+}
+
+// ParseProxy validates a proxy URL given on the command line.
+func ParseProxy(raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q, expected http, https or socks5", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("missing proxy host in %q", raw)
+	}
+	return u, nil
+}
+
+// newClient returns the HTTP client described by opts.
+func newClient(opts ClientOptions) *http.Client {
+	client := &http.Client{Timeout: opts.Timeout, Jar: newJar(opts)}
+	if client.Timeout == 0 {
+		client.Timeout = DefaultTimeout
+	}
+
+	var base http.RoundTripper
+	if opts.Proxy != nil || opts.TLS.configured() {
+		base = newTransport(opts, opts.TLS.config())
+	}
+	if len(opts.TLS.ClientCerts) > 0 {
+		// Connections are pooled by host, but a transport presents the
+		// same certificates to every server: one transport per host
+		routes := make([]hostRoute, len(opts.TLS.ClientCerts))
+		for i, cert := range opts.TLS.ClientCerts {
+			config := opts.TLS.config()
+			config.Certificates = []tls.Certificate{cert.Certificate}
+			routes[i] = hostRoute{host: cert.Host, transport: newTransport(opts, config)}
+		}
+		base = &hostTransport{routes: routes, fallback: base}
+	}
+
+	client.Transport = base
+	if len(opts.Headers) > 0 || len(opts.Auth) > 0 {
+		client.Transport = &authTransport{base: base, headers: opts.Headers, auth: opts.Auth}
+	}
+	return client
+}
+
+// newTransport returns a copy of http.DefaultTransport using the proxy of
+// opts and config.
+func newTransport(opts ClientOptions, config *tls.Config) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if opts.Proxy != nil {
+		transport.Proxy = http.ProxyURL(opts.Proxy)
+	}
+	transport.TLSClientConfig = config
+	return transport
+}
+
+// newJar returns an empty cookie jar when opts keep cookies, nil otherwise.
+func newJar(opts ClientOptions) http.CookieJar {
+	if !opts.Cookies {
+		return nil
+	}
+	// Only fails with invalid options
+	jar, _ := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+	return jar
+}
+
+// authTransport adds the default headers and the credentials of the host to
+// every request, redirects included, so that credentials are only ever sent
+// to the hosts they belong to.
+type authTransport struct {
+	// base sends the requests, http.DefaultTransport when nil
+	base    http.RoundTripper
+	headers http.Header
+	auth    []HostAuth
+}
+
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for name, values := range t.headers {
+		if req.Header.Get(name) == "" {
+			req.Header[http.CanonicalHeaderKey(name)] = values
+		}
+	}
+	for i := range t.auth {
+		if hostMatches(t.auth[i].Host, req.URL) {
+			t.auth[i].apply(req)
+			break
+		}
+	}
+
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(req)
+}
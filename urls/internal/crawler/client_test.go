@@ -0,0 +1,138 @@
+package crawler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadAuth(t *testing.T) {
+	t.Setenv("DOCS_PASSWORD", "s3cret")
+	t.Setenv("API_TOKEN", "t0ken")
+	path := filepath.Join(t.TempDir(), "auth.json")
+	write := func(content string) {
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	}
+
+	write(`[
+		{"host": "Docs.example.com", "username": "crawler", "password_env": "DOCS_PASSWORD"},
+		{"host": "*.api.example.com", "token_env": "API_TOKEN"},
+		{"host": "wiki.example.com:8443", "headers": {"X-Api-Key": "k"}}
+	]`)
+	auth, err := LoadAuth(path)
+	require.NoError(t, err)
+	assert.Equal(t, []HostAuth{
+		{Host: "docs.example.com", Username: "crawler", Password: "s3cret", PasswordEnv: "DOCS_PASSWORD"},
+		{Host: "*.api.example.com", Token: "t0ken", TokenEnv: "API_TOKEN"},
+		{Host: "wiki.example.com:8443", Headers: map[string]string{"X-Api-Key": "k"}},
+	}, auth)
+
+	for _, content := range []string{
+		`[{"username": "crawler"}]`,
+		`[{"host": "example.com", "token_env": "UNSET_TOKEN"}]`,
+		`[{"host": "example.com", "username": "crawler", "token": "t"}]`,
+		`{"host": "example.com"}`,
+	} {
+		write(content)
+		_, err := LoadAuth(path)
+		assert.Error(t, err, content)
+	}
+}
+
+func TestClientAuth(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	received := make(map[string]http.Header)
+	record := func(req *http.Request) (*http.Response, error) {
+		received[req.URL.String()] = req.Header
+		return httpmock.NewStringResponse(200, "ok"), nil
+	}
+	httpmock.RegisterResponder("GET", "https://docs.example.com/a", record)
+	httpmock.RegisterResponder("GET", "https://v1.api.example.com/b", record)
+	httpmock.RegisterResponder("GET", "https://wiki.example.com:8443/c", record)
+	httpmock.RegisterResponder("GET", "https://other.example.org/d", record)
+	httpmock.RegisterResponder("GET", "https://docs.example.com/moved",
+		httpmock.NewStringResponder(302, "").HeaderSet(http.Header{"Location": {"https://other.example.org/d"}}))
+
+	c := New(nil, Options{IgnoreRobots: true, Client: ClientOptions{
+		Headers: http.Header{"Accept-Language": {"en"}},
+		Auth: []HostAuth{
+			{Host: "docs.example.com", Username: "crawler", Password: "s3cret"},
+			{Host: "*.api.example.com", Token: "t0ken"},
+			{Host: "wiki.example.com:8443", Headers: map[string]string{"X-Api-Key": "k"}},
+		},
+	}})
+	for _, url := range []string{"https://docs.example.com/a", "https://v1.api.example.com/b", "https://wiki.example.com:8443/c", "https://docs.example.com/moved"} {
+		_, err := c.FetchURL(context.Background(), url)
+		require.NoError(t, err, url)
+	}
+
+	assert.Equal(t, "Basic Y3Jhd2xlcjpzM2NyZXQ=", received["https://docs.example.com/a"].Get("Authorization"))
+	assert.Equal(t, "Bearer t0ken", received["https://v1.api.example.com/b"].Get("Authorization"))
+	assert.Equal(t, "k", received["https://wiki.example.com:8443/c"].Get("X-Api-Key"))
+	// Credentials do not follow redirects to other hosts
+	assert.Empty(t, received["https://other.example.org/d"].Get("Authorization"))
+	for url, header := range received {
+		assert.Equal(t, "en", header.Get("Accept-Language"), url)
+		assert.Equal(t, DefaultUserAgent, header.Get("User-Agent"), url)
+	}
+}
+
+func TestClientCookies(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder("GET", "https://example.com/login",
+		httpmock.NewStringResponder(200, "").HeaderSet(http.Header{"Set-Cookie": {"session=abc; Path=/"}}))
+	httpmock.RegisterResponder("GET", "https://example.com/page", func(req *http.Request) (*http.Response, error) {
+		cookie, err := req.Cookie("session")
+		if err != nil {
+			return httpmock.NewStringResponse(401, ""), nil
+		}
+		return httpmock.NewStringResponse(200, cookie.Value), nil
+	})
+
+	ctx := context.Background()
+	c := New(nil, Options{IgnoreRobots: true, Client: ClientOptions{Cookies: true}})
+	_, err := c.FetchURL(ctx, "https://example.com/login")
+	require.NoError(t, err)
+	resp, err := c.FetchURL(ctx, "https://example.com/page")
+	require.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, "abc", string(resp.Body))
+
+	// Every job starts without cookies
+	resp, err = c.forJob(3).FetchURL(ctx, "https://example.com/page")
+	require.NoError(t, err)
+	assert.Equal(t, 401, resp.StatusCode)
+}
+
+func TestClientProxy(t *testing.T) {
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("proxied " + r.URL.String()))
+	}))
+	defer proxy.Close()
+
+	proxyURL, err := ParseProxy(proxy.URL)
+	require.NoError(t, err)
+	c := New(nil, Options{IgnoreRobots: true, Client: ClientOptions{Proxy: proxyURL}})
+	resp, err := c.FetchURL(context.Background(), "http://example.com/page")
+	require.NoError(t, err)
+	assert.Equal(t, "proxied http://example.com/page", string(resp.Body))
+
+	for _, raw := range []string{"socks5://127.0.0.1:1080", "https://proxy.example.com"} {
+		_, err := ParseProxy(raw)
+		assert.NoError(t, err, raw)
+	}
+	for _, raw := range []string{"ftp://proxy.example.com", "proxy.example.com:3128", "http://"} {
+		_, err := ParseProxy(raw)
+		assert.Error(t, err, raw)
+	}
+}
@@ -0,0 +1,221 @@
+package crawler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression is how stored bodies are compressed.
+type Compression string
+
+const (
+	NoCompression   Compression = "identity"
+	GzipCompression Compression = "gzip"
+	ZstdCompression Compression = "zstd"
+)
+
+// ParseCompression validates a compression name given on the command line.
+func ParseCompression(name string) (Compression, error) {
+	switch c := Compression(name); c {
+	case "", "none", NoCompression:
+		return NoCompression, nil
+	case GzipCompression, ZstdCompression:
+		return c, nil
+	}
+	return "", fmt.Errorf("unknown compression %q", name)
+}
+
+// ContentHash returns the hex encoded SHA-256 of body, which is the key
+// bodies are stored under.
+func ContentHash(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// contentChunkSize is the size of the rows large bodies are stored in.
+const contentChunkSize = 1 << 20
+
+// newCompressor returns a writer compressing into w with c. Closing it
+// flushes the compressed stream but does not close w.
+func newCompressor(c Compression, w io.Writer) (io.WriteCloser, error) {
+	switch c {
+	case "", NoCompression:
+		return nopWriteCloser{w}, nil
+	case GzipCompression:
+		return gzip.NewWriter(w), nil
+	case ZstdCompression:
+		return zstd.NewWriter(w)
+	}
+	return nil, fmt.Errorf("unknown compression %q", c)
+}
+
+// newDecompressor returns a reader decompressing r with c.
+func newDecompressor(c Compression, r io.Reader) (io.ReadCloser, error) {
+	switch c {
+	case "", NoCompression:
+		return io.NopCloser(r), nil
+	case GzipCompression:
+		return gzip.NewReader(r)
+	case ZstdCompression:
+		d, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	}
+	return nil, fmt.Errorf("unknown compression %q", c)
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+func compress(c Compression, data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := newCompressor(c, &buf)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decompress(c Compression, data []byte) ([]byte, error) {
+	r, err := newDecompressor(c, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// saveContent stores the body of resp in url_contents unless an identical body
+// is already there, and returns its hash.
+func (s *SQLStore) saveContent(ctx context.Context, resp *Response) (string, error) {
+	const insertContentQuery = `
+		INSERT INTO url_contents (hash, encoding, size, data, charset, text)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (hash) DO NOTHING`
+
+	hash := resp.Hash
+	if hash == "" {
+		hash = ContentHash(resp.Body)
+	}
+	if resp.spool != nil {
+		return hash, s.saveChunkedContent(ctx, hash, resp)
+	}
+
+	data, err := compress(s.compression, resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	var text interface{}
+	if resp.Charset != "" {
+		text = resp.Text
+	}
+
+	_, err = s.db.ExecContext(ctx, insertContentQuery, hash, string(s.compression), int64(len(resp.Body)), data,
+		nullString(resp.Charset), text)
+	if err != nil {
+		return "", err
+	}
+	return hash, nil
+}
+
+// saveChunkedContent streams a spooled body into url_content_chunks, so that
+// it is never held in memory as a whole.
+func (s *SQLStore) saveChunkedContent(ctx context.Context, hash string, resp *Response) error {
+	const insertContentQuery = `
+		INSERT INTO url_contents (hash, encoding, size)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (hash) DO NOTHING`
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, insertContentQuery, hash, string(s.compression), resp.ContentLength)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		// Already stored
+		return nil
+	}
+
+	body, err := resp.open()
+	if err != nil {
+		return err
+	}
+	chunks := &chunkWriter{ctx: ctx, tx: tx, hash: hash}
+	w, err := newCompressor(s.compression, chunks)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, body); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	if err := chunks.flush(); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// chunkWriter inserts everything written to it as contentChunkSize rows.
+type chunkWriter struct {
+	ctx  context.Context
+	tx   *sql.Tx
+	hash string
+	seq  int
+	buf  []byte
+}
+
+func (w *chunkWriter) Write(p []byte) (int, error) {
+	written := len(p)
+	for len(p) > 0 {
+		n := min(contentChunkSize-len(w.buf), len(p))
+		w.buf = append(w.buf, p[:n]...)
+		p = p[n:]
+		if len(w.buf) == contentChunkSize {
+			if err := w.flush(); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return written, nil
+}
+
+func (w *chunkWriter) flush() error {
+	const insertChunkQuery = `INSERT INTO url_content_chunks (hash, seq, data) VALUES ($1, $2, $3)`
+
+	if len(w.buf) == 0 {
+		return nil
+	}
+	if _, err := w.tx.ExecContext(w.ctx, insertChunkQuery, w.hash, w.seq, w.buf); err != nil {
+		return err
+	}
+	w.seq++
+	w.buf = w.buf[:0]
+	return nil
+}
@@ -0,0 +1,38 @@
+package crawler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompressRoundTrip(t *testing.T) {
+	body := []byte("<html><body>" + string(make([]byte, 1024)) + "</body></html>")
+
+	for _, c := range []Compression{NoCompression, GzipCompression, ZstdCompression} {
+		t.Run(string(c), func(t *testing.T) {
+			data, err := compress(c, body)
+			assert.NoError(t, err)
+			if c != NoCompression {
+				assert.Less(t, len(data), len(body))
+			}
+
+			decoded, err := decompress(c, data)
+			assert.NoError(t, err)
+			assert.Equal(t, body, decoded)
+		})
+	}
+}
+
+func TestParseCompression(t *testing.T) {
+	c, err := ParseCompression("none")
+	assert.NoError(t, err)
+	assert.Equal(t, NoCompression, c)
+
+	c, err = ParseCompression("zstd")
+	assert.NoError(t, err)
+	assert.Equal(t, ZstdCompression, c)
+
+	_, err = ParseCompression("lz4")
+	assert.Error(t, err)
+}
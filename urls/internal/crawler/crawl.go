@@ -0,0 +1,146 @@
+package crawler
+
+import (
+	"context"
+	"log"
+	"net/url"
+	"strings"
+)
+
+// CrawlOptions controls which links are followed in crawl mode.
+type CrawlOptions struct {
+	// MaxDepth is how many links away from a seed URL to follow; 0 only
+	// fetches the seeds.
+	MaxDepth int
+	// MaxPages caps the number of pages fetched; 0 means no limit.
+	MaxPages int
+	// AllowedDomains are followed in addition to the hosts of the seed URLs.
+	// Subdomains of an allowed domain are allowed as well.
+	AllowedDomains []string
+}
+
+// Crawl fetches the seed URLs, stores every page through SaveURL and follows
+// the links found in HTML pages according to opts. One Result is sent per
+// fetched page.
+func (p *Pool) Crawl(ctx context.Context, c *Crawler, seeds []string, opts CrawlOptions) <-chan Result {
+	state := newCrawlState(seeds, opts)
+
+	tasks := make([]task, 0, len(seeds))
+	for _, s := range seeds {
+		tasks = append(tasks, task{url: s})
+	}
+	return p.process(ctx, state.admit(tasks), state.admit, func(ctx context.Context, t task) ([]task, Result) {
+		return c.crawlPage(ctx, t, opts.MaxDepth)
+	})
+}
+
+// crawlState decides which of the discovered links are crawled.
+type crawlState struct {
+	opts     CrawlOptions
+	scope    *scope
+	seen     map[string]bool
+	admitted int
+}
+
+func newCrawlState(seeds []string, opts CrawlOptions) *crawlState {
+	return &crawlState{opts: opts, scope: newScope(seeds, opts.AllowedDomains), seen: make(map[string]bool)}
+}
+
+// admit drops the tasks already seen, too deep, out of scope or over
+// MaxPages.
+func (s *crawlState) admit(tasks []task) []task {
+	var admitted []task
+	for _, t := range tasks {
+		if s.seen[t.url] || t.depth > s.opts.MaxDepth || !s.scope.allows(t.url) {
+			continue
+		}
+		if s.opts.MaxPages > 0 && s.admitted >= s.opts.MaxPages {
+			continue
+		}
+		s.seen[t.url] = true
+		s.admitted++
+		admitted = append(admitted, t)
+	}
+	return admitted
+}
+
+// crawlPage fetches and stores a page and returns the links to follow from
+// it, unless it is maxDepth links away from a seed.
+func (c *Crawler) crawlPage(ctx context.Context, t task, maxDepth int) ([]task, Result) {
+	resp, result := c.visit(ctx, t.url)
+	if result.Err != nil {
+		return nil, result
+	}
+	defer resp.Close()
+
+	if t.depth >= maxDepth {
+		return nil, result
+	}
+	if resp.Unchanged != nil {
+		// Links of an unchanged page come from the snapshot it revalidated
+		snapshot, err := c.store.LoadSnapshot(ctx, resp.Unchanged.ID)
+		if err != nil {
+			log.Printf("failed to load snapshot of %s: %v", t.url, err)
+			return nil, result
+		}
+		resp = snapshot
+	}
+	if !resp.IsHTML() || resp.Body == nil {
+		// Bodies too large to keep in memory are not parsed
+		return nil, result
+	}
+	links, err := ExtractLinks(resp.FinalURL, resp.HTML())
+	if err != nil {
+		// The page itself was stored; only link discovery failed
+		log.Printf("failed to extract links from %s: %v", t.url, err)
+		return nil, result
+	}
+
+	found := make([]task, 0, len(links))
+	for _, link := range links {
+		if c.opts.Normalizer != nil {
+			if link, err = c.opts.Normalizer.Normalize(link); err != nil {
+				continue
+			}
+		}
+		found = append(found, task{url: link, depth: t.depth + 1})
+	}
+	return found, result
+}
+
+// scope decides whether a discovered URL may be crawled.
+type scope struct {
+	hosts   map[string]bool
+	domains []string
+}
+
+func newScope(seeds, allowedDomains []string) *scope {
+	s := &scope{hosts: make(map[string]bool)}
+	for _, seed := range seeds {
+		s.hosts[hostOf(seed)] = true
+	}
+	for _, d := range allowedDomains {
+		d = strings.ToLower(strings.Trim(strings.TrimSpace(d), "."))
+		if d != "" {
+			s.domains = append(s.domains, d)
+		}
+	}
+	return s
+}
+
+func (s *scope) allows(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	if s.hosts[host] {
+		return true
+	}
+	for _, d := range s.domains {
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+package crawler
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"url.com/data/internal/urlnorm"
+)
+
+func TestExtractLinks(t *testing.T) {
+	body := []byte(`<html><body>
+		<a href="/docs/intro#setup">Intro</a>
+		<a href="guide.html">Guide</a>
+		<a href="https://other.example.org/x">Other</a>
+		<a href="mailto:team@example.com">Mail</a>
+		<a href="/docs/intro">Intro again</a>
+	</body></html>`)
+
+	links, err := ExtractLinks("https://example.com/docs/index.html", body)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"https://example.com/docs/intro",
+		"https://example.com/docs/guide.html",
+		"https://other.example.org/x",
+	}, links)
+}
+
+func TestCrawl(t *testing.T) {
+	pages := map[string]string{
+		"https://example.com/":  `<html><a href="/a">a</a><a href="/b">b</a><a href="https://elsewhere.org/">x</a></html>`,
+		"https://example.com/a": `<html><a href="/c">c</a><a href="/">home</a></html>`,
+		"https://example.com/b": `<html>no links</html>`,
+		"https://example.com/c": `<html>too deep</html>`,
+	}
+
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	for u, body := range pages {
+		httpmock.RegisterResponder("GET", u, httpmock.NewStringResponder(200, body))
+	}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.MatchExpectationsInOrder(false)
+	for i := 0; i < 3; i++ {
+		mock.ExpectExec(`INSERT INTO url_contents`).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(`INSERT INTO url_responses`).WillReturnResult(sqlmock.NewResult(1, 1))
+	}
+
+	pool := NewPool(2, 1)
+	c := New(NewPostgresStore(db, NoCompression), Options{IgnoreRobots: true})
+	var fetched []string
+	for result := range pool.Crawl(context.Background(), c, []string{"https://example.com/"}, CrawlOptions{MaxDepth: 1}) {
+		assert.NoError(t, result.Err)
+		fetched = append(fetched, result.URL)
+	}
+
+	sort.Strings(fetched)
+	assert.Equal(t, []string{"https://example.com/", "https://example.com/a", "https://example.com/b"}, fetched)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unmet expectations: %v", err)
+	}
+}
+
+func TestCrawlCanonicalLinks(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder("GET", "https://example.com/",
+		httpmock.NewStringResponder(200, `<html><a href="HTTPS://Example.com:443/a">a</a><a href="/a?utm_source=x">a</a><a href="/b?y=2&x=1">b</a><a href="/b?x=1&y=2#top">b</a></html>`))
+	httpmock.RegisterResponder("GET", "https://example.com/a", httpmock.NewStringResponder(200, "a"))
+	httpmock.RegisterResponder("GET", "https://example.com/b?x=1&y=2", httpmock.NewStringResponder(200, "b"))
+
+	store, err := OpenFileStore(t.TempDir(), NoCompression)
+	require.NoError(t, err)
+	defer store.Close()
+
+	normalizer := urlnorm.New(urlnorm.Options{StripParams: urlnorm.DefaultStripParams, SortQuery: true})
+	c := New(store, Options{IgnoreRobots: true, Normalizer: normalizer})
+	var fetched []string
+	for result := range NewPool(2, 1).Crawl(context.Background(), c, []string{"https://example.com/"}, CrawlOptions{MaxDepth: 1}) {
+		assert.NoError(t, result.Err)
+		fetched = append(fetched, result.URL)
+	}
+
+	sort.Strings(fetched)
+	assert.Equal(t, []string{"https://example.com/", "https://example.com/a", "https://example.com/b?x=1&y=2"}, fetched)
+}
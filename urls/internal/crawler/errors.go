@@ -0,0 +1,96 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+)
+
+// ErrorKind classifies why a URL could not be fetched.
+type ErrorKind int
+
+const (
+	// Transient failures (timeouts, resets, 429, 502/503/504) may succeed later.
+	Transient ErrorKind = iota + 1
+	// Permanent failures (4xx, bad URLs, unknown hosts) will not.
+	Permanent
+	// Policy failures are URLs we chose not to fetch, e.g. because of robots.txt.
+	Policy
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case Transient:
+		return "transient"
+	case Permanent:
+		return "permanent"
+	case Policy:
+		return "policy"
+	default:
+		return "unknown"
+	}
+}
+
+// FetchError is returned by FetchURL when a URL could not be fetched.
+type FetchError struct {
+	URL        string
+	Kind       ErrorKind
+	StatusCode int
+	Attempts   int
+	Err        error
+}
+
+func (e *FetchError) Error() string {
+	return fmt.Sprintf("%s failure fetching %s after %d attempt(s): %v", e.Kind, e.URL, e.Attempts, e.Err)
+}
+
+func (e *FetchError) Unwrap() error {
+	return e.Err
+}
+
+// KindOf returns the ErrorKind of err, or 0 if err is not a FetchError.
+func KindOf(err error) ErrorKind {
+	var fetchErr *FetchError
+	if errors.As(err, &fetchErr) {
+		return fetchErr.Kind
+	}
+	return 0
+}
+
+// statusError classifies an unsuccessful HTTP status.
+func statusError(url string, code int) *FetchError {
+	kind := Permanent
+	if isRetryableStatus(code) {
+		kind = Transient
+	}
+	return &FetchError{URL: url, Kind: kind, StatusCode: code, Err: fmt.Errorf("unexpected status %d %s", code, http.StatusText(code))}
+}
+
+// transportError classifies an error returned while sending a request or
+// reading its response.
+func transportError(url string, err error) *FetchError {
+	kind := Permanent
+
+	var netErr net.Error
+	var dnsErr *net.DNSError
+	switch {
+	case errors.As(err, &dnsErr):
+		if dnsErr.IsTimeout || dnsErr.IsTemporary {
+			kind = Transient
+		}
+	case errors.Is(err, context.Canceled),
+		errors.Is(err, context.DeadlineExceeded),
+		errors.As(err, &netErr) && netErr.Timeout(),
+		errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, syscall.ECONNREFUSED),
+		errors.Is(err, syscall.EPIPE),
+		errors.Is(err, io.EOF),
+		errors.Is(err, io.ErrUnexpectedEOF):
+		kind = Transient
+	}
+	return &FetchError{URL: url, Kind: kind, Err: err}
+}
@@ -0,0 +1,416 @@
+package crawler
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FileStore stores responses in a directory: their metadata is appended to
+// responses.jsonl and bodies are written once per content hash under
+// contents/. Extracted fields go to extracted.jsonl. It needs no database,
+// which makes it handy for local crawls.
+type FileStore struct {
+	dir         string
+	compression Compression
+
+	mu   sync.Mutex
+	file *os.File
+	// extracted is opened on the first extracted value
+	extracted *os.File
+	nextID    int64
+	records   map[int64]fileRecord
+	// history lists the ids of the 2xx responses with a body of each URL
+	history map[string][]int64
+}
+
+// extractedRecord is a line of extracted.jsonl. Field names follow the
+// extracted_fields columns.
+type extractedRecord struct {
+	JobID     int64     `json:"job_id,omitempty"`
+	URL       string    `json:"url"`
+	FinalURL  string    `json:"final_url"`
+	Field     string    `json:"field"`
+	Seq       int       `json:"seq"`
+	Value     string    `json:"value"`
+	FetchedAt time.Time `json:"fetched_at"`
+}
+
+// fileRecord is a line of responses.jsonl. Field names follow the
+// url_responses columns.
+type fileRecord struct {
+	ID            int64       `json:"id"`
+	URL           string      `json:"url"`
+	FinalURL      string      `json:"final_url"`
+	StatusCode    int         `json:"status_code"`
+	Header        http.Header `json:"headers,omitempty"`
+	ContentType   string      `json:"content_type,omitempty"`
+	ContentLength int64       `json:"content_length"`
+	ContentHash   string      `json:"content_hash,omitempty"`
+	Charset       string      `json:"charset,omitempty"`
+	DurationMs    int64       `json:"fetch_duration_ms"`
+	FetchedAt     time.Time   `json:"fetched_at"`
+	ETag          string      `json:"etag,omitempty"`
+	LastModified  string      `json:"last_modified,omitempty"`
+	UnchangedFrom int64       `json:"unchanged_from,omitempty"`
+	Truncated     bool        `json:"truncated,omitempty"`
+	Metadata      *Metadata   `json:"metadata,omitempty"`
+	TLS           *TLSInfo    `json:"tls,omitempty"`
+	JobID         int64       `json:"job_id,omitempty"`
+}
+
+// OpenFileStore opens (creating if needed) the store in dir. Bodies are
+// compressed with compression.
+func OpenFileStore(dir string, compression Compression) (*FileStore, error) {
+	if compression == "" {
+		compression = NoCompression
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "contents"), 0o755); err != nil {
+		return nil, err
+	}
+
+	s := &FileStore{
+		dir:         dir,
+		compression: compression,
+		nextID:      1,
+		records:     make(map[int64]fileRecord),
+		history:     make(map[string][]int64),
+	}
+	if err := s.loadIndex(); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(filepath.Join(dir, "responses.jsonl"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	s.file = file
+	return s, nil
+}
+
+// loadIndex reads the records written by previous runs so that their
+// snapshots can be revalidated.
+func (s *FileStore) loadIndex() error {
+	file, err := os.Open(filepath.Join(s.dir, "responses.jsonl"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16<<20)
+	line := 0
+	for scanner.Scan() {
+		line++
+		var record fileRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			// A partly written last line is dropped rather than failing the run
+			log.Printf("skipping line %d of %s: %v", line, file.Name(), err)
+			continue
+		}
+		s.index(record)
+	}
+	return scanner.Err()
+}
+
+// index remembers record for LastSnapshot and LoadSnapshot. Callers hold mu
+// or own s exclusively.
+func (s *FileStore) index(record fileRecord) {
+	record.Header, record.Metadata, record.TLS = nil, nil, nil
+	s.records[record.ID] = record
+	if record.ID >= s.nextID {
+		s.nextID = record.ID + 1
+	}
+	if record.UnchangedFrom == 0 && record.StatusCode >= 200 && record.StatusCode <= 299 {
+		s.history[record.URL] = append(s.history[record.URL], record.ID)
+	}
+}
+
+// SaveResponse writes the body of resp under contents/ and appends its
+// metadata to responses.jsonl.
+func (s *FileStore) SaveResponse(ctx context.Context, resp *Response) error {
+	record := fileRecord{
+		URL:           resp.URL,
+		FinalURL:      resp.FinalURL,
+		StatusCode:    resp.StatusCode,
+		Header:        resp.Header,
+		ContentType:   resp.ContentType,
+		ContentLength: resp.ContentLength,
+		DurationMs:    resp.Duration.Milliseconds(),
+		FetchedAt:     resp.FetchedAt,
+		ETag:          resp.ETag,
+		LastModified:  resp.LastModified,
+		Truncated:     resp.Truncated,
+		Metadata:      resp.Metadata,
+		TLS:           resp.TLS,
+		JobID:         resp.JobID,
+	}
+	if resp.Unchanged != nil {
+		record.UnchangedFrom = resp.Unchanged.ID
+	} else {
+		hash, err := s.saveContent(resp)
+		if err != nil {
+			log.Printf("failed to store content of URL %s: %v", resp.URL, err)
+			return err
+		}
+		record.ContentHash = hash
+		record.Charset = resp.Charset
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record.ID = s.nextID
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		log.Printf("failed to write URL %s to %s: %v", resp.URL, s.file.Name(), err)
+		return err
+	}
+	s.index(record)
+	return s.saveExtracted(resp)
+}
+
+// saveExtracted appends the values extracted from resp to extracted.jsonl.
+// Callers hold mu.
+func (s *FileStore) saveExtracted(resp *Response) error {
+	if len(resp.Extracted) == 0 {
+		return nil
+	}
+	if s.extracted == nil {
+		file, err := os.OpenFile(filepath.Join(s.dir, "extracted.jsonl"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return err
+		}
+		s.extracted = file
+	}
+
+	var lines []byte
+	for _, v := range resp.Extracted {
+		line, err := json.Marshal(extractedRecord{
+			JobID: resp.JobID, URL: resp.URL, FinalURL: resp.FinalURL,
+			Field: v.Field, Seq: v.Seq, Value: v.Value, FetchedAt: resp.FetchedAt,
+		})
+		if err != nil {
+			return err
+		}
+		lines = append(append(lines, line...), '\n')
+	}
+	if _, err := s.extracted.Write(lines); err != nil {
+		log.Printf("failed to write fields extracted from URL %s to %s: %v", resp.URL, s.extracted.Name(), err)
+		return err
+	}
+	return nil
+}
+
+// contentPath returns where a body with the given hash and compression is
+// stored.
+func (s *FileStore) contentPath(hash string, compression Compression) string {
+	name := hash
+	switch compression {
+	case GzipCompression:
+		name += ".gz"
+	case ZstdCompression:
+		name += ".zst"
+	}
+	return filepath.Join(s.dir, "contents", hash[:2], name)
+}
+
+// findContent returns the path and compression of the stored body with the
+// given hash, which may have been written with another compression by an
+// earlier run.
+func (s *FileStore) findContent(hash string) (string, Compression, error) {
+	for _, c := range []Compression{s.compression, NoCompression, GzipCompression, ZstdCompression} {
+		path := s.contentPath(hash, c)
+		if _, err := os.Stat(path); err == nil {
+			return path, c, nil
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return "", "", err
+		}
+	}
+	return "", "", os.ErrNotExist
+}
+
+// saveContent writes the body of resp unless an identical body is already
+// stored, and returns its hash. Decoded text is kept next to it when it
+// differs from the raw bytes.
+func (s *FileStore) saveContent(resp *Response) (string, error) {
+	hash := resp.Hash
+	if hash == "" {
+		hash = ContentHash(resp.Body)
+	}
+	if _, _, err := s.findContent(hash); err == nil {
+		return hash, nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+
+	body, err := resp.open()
+	if err != nil {
+		return "", err
+	}
+	path := s.contentPath(hash, s.compression)
+	err = writeFileAtomic(path, func(w io.Writer) error {
+		cw, err := newCompressor(s.compression, w)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(cw, body); err != nil {
+			return err
+		}
+		return cw.Close()
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if resp.Charset != "" && resp.Text != string(resp.Body) {
+		err = writeFileAtomic(s.contentPath(hash, NoCompression)+".txt", func(w io.Writer) error {
+			_, err := io.WriteString(w, resp.Text)
+			return err
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+	return hash, nil
+}
+
+// writeFileAtomic writes path through a temporary file renamed into place, so
+// that concurrent writers of the same body and interrupted runs never leave a
+// partial file behind.
+func writeFileAtomic(path string, write func(io.Writer) error) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// LastSnapshot returns the most recent stored 2xx response of url that has a
+// body, or nil if there is none.
+func (s *FileStore) LastSnapshot(ctx context.Context, url string) (*Snapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := s.history[url]
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	record := s.records[ids[len(ids)-1]]
+	return &Snapshot{ID: record.ID, ETag: record.ETag, LastModified: record.LastModified}, nil
+}
+
+// Snapshots returns up to limit stored 2xx responses of url that have a body,
+// most recent first.
+func (s *FileStore) Snapshots(ctx context.Context, url string, limit int) ([]Snapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := s.history[url]
+	var snapshots []Snapshot
+	for i := len(ids) - 1; i >= 0 && len(snapshots) < limit; i-- {
+		record := s.records[ids[i]]
+		snapshots = append(snapshots, Snapshot{
+			ID: record.ID, ETag: record.ETag, LastModified: record.LastModified,
+			FetchedAt: record.FetchedAt, ContentHash: record.ContentHash,
+		})
+	}
+	return snapshots, nil
+}
+
+// LoadSnapshot returns the stored response with the given id, following
+// unchanged responses to the body they revalidated.
+func (s *FileStore) LoadSnapshot(ctx context.Context, id int64) (*Response, error) {
+	s.mu.Lock()
+	record, ok := s.records[id]
+	s.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("no stored response with id %d", id)
+	}
+
+	resp := &Response{
+		URL:         record.URL,
+		FinalURL:    record.FinalURL,
+		StatusCode:  record.StatusCode,
+		ContentType: record.ContentType,
+		Hash:        record.ContentHash,
+	}
+	if record.UnchangedFrom != 0 {
+		previous, err := s.LoadSnapshot(ctx, record.UnchangedFrom)
+		if err != nil {
+			return nil, err
+		}
+		resp.Body, resp.Hash = previous.Body, previous.Hash
+		resp.Charset, resp.Text = previous.Charset, previous.Text
+		if resp.ContentType == "" {
+			resp.ContentType = previous.ContentType
+		}
+	} else if record.ContentHash != "" {
+		path, compression, err := s.findContent(record.ContentHash)
+		if err != nil {
+			return nil, err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if resp.Body, err = decompress(compression, data); err != nil {
+			return nil, err
+		}
+		if record.Charset != "" {
+			resp.Charset = record.Charset
+			text, err := os.ReadFile(s.contentPath(record.ContentHash, NoCompression) + ".txt")
+			switch {
+			case err == nil:
+				resp.Text = string(text)
+			case errors.Is(err, os.ErrNotExist):
+				resp.Text = string(resp.Body)
+			default:
+				return nil, err
+			}
+		}
+	}
+
+	resp.ContentLength = int64(len(resp.Body))
+	return resp, nil
+}
+
+// Close closes responses.jsonl and extracted.jsonl.
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.extracted != nil {
+		if err := s.extracted.Close(); err != nil {
+			s.file.Close()
+			return err
+		}
+	}
+	return s.file.Close()
+}
@@ -0,0 +1,473 @@
+package crawler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Job states in crawl_jobs.
+const (
+	JobRunning = "running"
+	JobDone    = "done"
+)
+
+// URL states in crawl_queue.
+const (
+	StatePending    = "pending"
+	StateInProgress = "in_progress"
+	StateDone       = "done"
+	StateFailed     = "failed"
+)
+
+// Job is a crawl whose frontier is stored in crawl_queue, so that it can be
+// resumed after the process stopped.
+type Job struct {
+	ID     int64
+	Status string
+	// Crawl is set when links are followed, according to Options.
+	Crawl     bool
+	Options   CrawlOptions
+	CreatedAt time.Time
+}
+
+// Frontier stores the URLs queued by crawl jobs in Postgres, along with
+// whether each of them is pending, in progress, done or failed. Several
+// processes can work on the same job: each claims batches of pending URLs
+// under a lease that it renews with heartbeats, and URLs whose lease ran out
+// are claimed again by someone else.
+type Frontier struct {
+	db       *sql.DB
+	workerID string
+	lease    time.Duration
+}
+
+// DefaultLease is how long a claimed URL stays with a worker that stopped
+// sending heartbeats.
+const DefaultLease = time.Minute
+
+// MaxAttempts is how many times a URL is claimed before it is marked failed,
+// so that a URL whose workers keep crashing or losing their lease does not
+// keep the job running forever.
+const MaxAttempts = 5
+
+// claimPollInterval is how often a worker with nothing to claim checks
+// whether the URLs held by other workers led to more.
+const claimPollInterval = time.Second
+
+// NewFrontier returns a frontier stored in db, which must have been migrated.
+// workerID identifies this process in the leases it takes; a worker started
+// again with the same ID takes back its URLs without waiting for the lease.
+func NewFrontier(db *sql.DB, workerID string, lease time.Duration) *Frontier {
+	if lease <= 0 {
+		lease = DefaultLease
+	}
+	return &Frontier{db: db, workerID: workerID, lease: lease}
+}
+
+// CreateJob stores a new job and queues its seed URLs.
+func (f *Frontier) CreateJob(ctx context.Context, crawl bool, opts CrawlOptions, seeds []string) (*Job, error) {
+	const insertJobQuery = `
+		INSERT INTO crawl_jobs (status, crawl, options)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at`
+
+	options, err := json.Marshal(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	job := &Job{Status: JobRunning, Crawl: crawl, Options: opts}
+	err = f.db.QueryRowContext(ctx, insertJobQuery, JobRunning, crawl, string(options)).Scan(&job.ID, &job.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create job: %w", err)
+	}
+
+	tasks := make([]task, 0, len(seeds))
+	for _, s := range seeds {
+		tasks = append(tasks, task{url: s})
+	}
+	if err := f.add(ctx, job.ID, tasks, 0); err != nil {
+		return nil, fmt.Errorf("failed to queue seed URLs of job %d: %w", job.ID, err)
+	}
+	return job, nil
+}
+
+// LoadJob returns the job with the given id.
+func (f *Frontier) LoadJob(ctx context.Context, id int64) (*Job, error) {
+	const selectJobQuery = `
+		SELECT id, status, crawl, COALESCE(options, '{}'), created_at
+		FROM crawl_jobs
+		WHERE id = $1`
+
+	job := &Job{}
+	var options []byte
+	err := f.db.QueryRowContext(ctx, selectJobQuery, id).Scan(&job.ID, &job.Status, &job.Crawl, &options, &job.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load job %d: %w", id, err)
+	}
+	if err := json.Unmarshal(options, &job.Options); err != nil {
+		return nil, fmt.Errorf("failed to decode options of job %d: %w", id, err)
+	}
+	return job, nil
+}
+
+// add queues tasks for the job, skipping URLs it has queued before. When
+// maxPages is set, no more URLs are added once the job has queued that many,
+// however many workers are adding to it.
+func (f *Frontier) add(ctx context.Context, jobID int64, tasks []task, maxPages int) error {
+	const lockJobQuery = `SELECT id FROM crawl_jobs WHERE id = $1 FOR UPDATE`
+	const countQueueQuery = `SELECT count(*) FROM crawl_queue WHERE job_id = $1`
+	const insertQueueQuery = `
+		INSERT INTO crawl_queue (job_id, url, depth)
+		SELECT $1, t.url, t.depth
+		FROM unnest($2::text[], $3::integer[]) WITH ORDINALITY AS t (url, depth, n)
+		WHERE NOT EXISTS (SELECT 1 FROM crawl_queue q WHERE q.job_id = $1 AND q.url = t.url)
+		ORDER BY t.n
+		LIMIT $4
+		ON CONFLICT (job_id, url) DO NOTHING`
+
+	if len(tasks) == 0 {
+		return nil
+	}
+	urls := make([]string, len(tasks))
+	depths := make([]int64, len(tasks))
+	for i, t := range tasks {
+		urls[i], depths[i] = t.url, int64(t.depth)
+	}
+
+	tx, err := f.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var limit interface{}
+	if maxPages > 0 {
+		// Serialize the workers adding to the job so that the count holds
+		if _, err := tx.ExecContext(ctx, lockJobQuery, jobID); err != nil {
+			return err
+		}
+		var queued int
+		if err := tx.QueryRowContext(ctx, countQueueQuery, jobID).Scan(&queued); err != nil {
+			return err
+		}
+		if queued >= maxPages {
+			return nil
+		}
+		limit = maxPages - queued
+	}
+
+	if _, err := tx.ExecContext(ctx, insertQueueQuery, jobID, pq.Array(urls), pq.Array(depths), limit); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// seeds returns the URLs the job started from.
+func (f *Frontier) seeds(ctx context.Context, jobID int64) ([]string, error) {
+	const selectSeedsQuery = `SELECT url FROM crawl_queue WHERE job_id = $1 AND depth = 0 ORDER BY id`
+
+	rows, err := f.db.QueryContext(ctx, selectSeedsQuery, jobID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var seeds []string
+	for rows.Next() {
+		var url string
+		if err := rows.Scan(&url); err != nil {
+			return nil, err
+		}
+		seeds = append(seeds, url)
+	}
+	return seeds, rows.Err()
+}
+
+// claim takes up to n URLs of the job that are pending or whose lease ran
+// out, skipping the ones other workers are claiming at the same time. URLs
+// claimed MaxAttempts times already are marked failed instead.
+func (f *Frontier) claim(ctx context.Context, jobID int64, n int) ([]task, error) {
+	const claimQuery = `
+		WITH exhausted AS (
+			UPDATE crawl_queue
+			SET state = $8, error = $9, locked_by = NULL, lease_until = NULL, updated_at = now()
+			WHERE job_id = $1 AND attempts >= $7 AND (state = $2 OR (state = $3 AND lease_until < now())))
+		UPDATE crawl_queue
+		SET state = $3, locked_by = $4, lease_until = now() + $5::interval,
+		    attempts = attempts + 1, updated_at = now()
+		WHERE id IN (
+			SELECT id FROM crawl_queue
+			WHERE job_id = $1 AND attempts < $7 AND (state = $2 OR (state = $3 AND lease_until < now()))
+			ORDER BY id
+			LIMIT $6
+			FOR UPDATE SKIP LOCKED)
+		RETURNING id, url, depth`
+
+	rows, err := f.db.QueryContext(ctx, claimQuery, jobID, StatePending, StateInProgress, f.workerID,
+		f.leaseInterval(), n, MaxAttempts, StateFailed, fmt.Sprintf("gave up after %d attempts", MaxAttempts))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	type claimed struct {
+		id int64
+		task
+	}
+	var batch []claimed
+	for rows.Next() {
+		var c claimed
+		if err := rows.Scan(&c.id, &c.url, &c.depth); err != nil {
+			return nil, err
+		}
+		batch = append(batch, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// RETURNING does not keep the order of the subquery
+	sort.Slice(batch, func(i, j int) bool { return batch[i].id < batch[j].id })
+	tasks := make([]task, len(batch))
+	for i, c := range batch {
+		tasks[i] = c.task
+	}
+	return tasks, nil
+}
+
+// leaseInterval formats the lease as a Postgres interval.
+func (f *Frontier) leaseInterval() string {
+	return fmt.Sprintf("%d milliseconds", f.lease.Milliseconds())
+}
+
+// heartbeat renews the lease on the URLs this worker holds.
+func (f *Frontier) heartbeat(ctx context.Context, jobID int64) error {
+	const heartbeatQuery = `
+		UPDATE crawl_queue SET lease_until = now() + $4::interval
+		WHERE job_id = $1 AND locked_by = $2 AND state = $3`
+
+	_, err := f.db.ExecContext(ctx, heartbeatQuery, jobID, f.workerID, StateInProgress, f.leaseInterval())
+	return err
+}
+
+// finish records the outcome of a URL this worker holds. Nothing is written
+// if the lease was lost to another worker in the meantime.
+func (f *Frontier) finish(ctx context.Context, jobID int64, result Result) error {
+	const finishQuery = `
+		UPDATE crawl_queue SET state = $4, error = $5, locked_by = NULL, lease_until = NULL, updated_at = now()
+		WHERE job_id = $1 AND url = $2 AND locked_by = $3`
+
+	state, errMessage := StateDone, sql.NullString{}
+	if result.Err != nil {
+		state, errMessage = StateFailed, sql.NullString{String: result.Err.Error(), Valid: true}
+	}
+	_, err := f.db.ExecContext(ctx, finishQuery, jobID, result.URL, f.workerID, state, errMessage)
+	return err
+}
+
+// release puts the URLs this worker holds back to pending, or only url when
+// it is set. It is used for URLs interrupted by a shutdown or left behind by
+// an earlier run with the same worker ID.
+func (f *Frontier) release(ctx context.Context, jobID int64, url string) error {
+	const releaseQuery = `
+		UPDATE crawl_queue SET state = $4, locked_by = NULL, lease_until = NULL, updated_at = now()
+		WHERE job_id = $1 AND locked_by = $2 AND state = $3 AND ($5::text = '' OR url = $5)`
+
+	_, err := f.db.ExecContext(ctx, releaseQuery, jobID, f.workerID, StateInProgress, StatePending, url)
+	return err
+}
+
+// remaining counts the URLs of the job that are pending or held by a worker.
+func (f *Frontier) remaining(ctx context.Context, jobID int64) (int, error) {
+	const remainingQuery = `SELECT count(*) FROM crawl_queue WHERE job_id = $1 AND state IN ($2, $3)`
+
+	var n int
+	err := f.db.QueryRowContext(ctx, remainingQuery, jobID, StatePending, StateInProgress).Scan(&n)
+	return n, err
+}
+
+// Progress counts the URLs of a job by state.
+type Progress struct {
+	Pending    int `json:"pending"`
+	InProgress int `json:"in_progress"`
+	Done       int `json:"done"`
+	Failed     int `json:"failed"`
+}
+
+// Total is the number of URLs the job has queued.
+func (p Progress) Total() int {
+	return p.Pending + p.InProgress + p.Done + p.Failed
+}
+
+// Progress counts the URLs of the job in each state.
+func (f *Frontier) Progress(ctx context.Context, jobID int64) (Progress, error) {
+	const progressQuery = `SELECT state, count(*) FROM crawl_queue WHERE job_id = $1 GROUP BY state`
+
+	var p Progress
+	rows, err := f.db.QueryContext(ctx, progressQuery, jobID)
+	if err != nil {
+		return p, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var state string
+		var n int
+		if err := rows.Scan(&state, &n); err != nil {
+			return p, err
+		}
+		switch state {
+		case StatePending:
+			p.Pending = n
+		case StateInProgress:
+			p.InProgress = n
+		case StateDone:
+			p.Done = n
+		case StateFailed:
+			p.Failed = n
+		}
+	}
+	return p, rows.Err()
+}
+
+// complete marks the job done once none of its URLs are left to crawl.
+func (f *Frontier) complete(ctx context.Context, jobID int64) (bool, error) {
+	const completeQuery = `
+		UPDATE crawl_jobs SET status = $2, finished_at = now()
+		WHERE id = $1 AND status <> $2 AND NOT EXISTS (
+			SELECT 1 FROM crawl_queue WHERE job_id = $1 AND state IN ($3, $4))`
+
+	res, err := f.db.ExecContext(ctx, completeQuery, jobID, JobDone, StatePending, StateInProgress)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// RunJob crawls the job until none of its URLs are left, claiming them from
+// the frontier in batches so that any number of processes can work on the
+// same job. URLs finished by an earlier run are skipped, and in crawl mode
+// discovered links are added to the frontier for whichever worker claims
+// them next.
+func (p *Pool) RunJob(ctx context.Context, c *Crawler, f *Frontier, job *Job) (<-chan Result, error) {
+	c = c.forJob(job.ID)
+	seeds, err := f.seeds(ctx, job.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load seed URLs of job %d: %w", job.ID, err)
+	}
+	if err := f.release(ctx, job.ID, ""); err != nil {
+		return nil, fmt.Errorf("failed to release URLs of job %d: %w", job.ID, err)
+	}
+
+	// Queue bookkeeping must survive the shutdown of ctx
+	dbCtx := context.WithoutCancel(ctx)
+
+	var admit func([]task) []task
+	handle := func(ctx context.Context, t task) ([]task, Result) {
+		return nil, c.Visit(ctx, t.url)
+	}
+	if job.Crawl {
+		scope := newScope(seeds, job.Options.AllowedDomains)
+		admit = func(tasks []task) []task {
+			var follow []task
+			for _, t := range tasks {
+				if t.depth <= job.Options.MaxDepth && scope.allows(t.url) {
+					follow = append(follow, t)
+				}
+			}
+			if err := f.add(dbCtx, job.ID, follow, job.Options.MaxPages); err != nil {
+				log.Printf("failed to queue %d URLs for job %d: %v", len(follow), job.ID, err)
+			}
+			// Claimed from the frontier like every other URL
+			return nil
+		}
+		handle = func(ctx context.Context, t task) ([]task, Result) {
+			return c.crawlPage(ctx, t, job.Options.MaxDepth)
+		}
+	}
+	work := func(workCtx context.Context, t task) ([]task, Result) {
+		found, result := handle(workCtx, t)
+		if result.Err != nil && workCtx.Err() != nil {
+			// Cut short by a shutdown, crawl it again later
+			if err := f.release(dbCtx, job.ID, t.url); err != nil {
+				log.Printf("failed to release %s for job %d: %v", t.url, job.ID, err)
+			}
+			return found, result
+		}
+		if err := f.finish(dbCtx, job.ID, result); err != nil {
+			log.Printf("failed to record %s for job %d: %v", t.url, job.ID, err)
+		}
+		return found, result
+	}
+
+	out := make(chan Result)
+	go func() {
+		defer close(out)
+
+		heartbeatCtx, stopHeartbeat := context.WithCancel(dbCtx)
+		defer stopHeartbeat()
+		go func() {
+			ticker := time.NewTicker(f.lease / 3)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					if err := f.heartbeat(heartbeatCtx, job.ID); err != nil && heartbeatCtx.Err() == nil {
+						log.Printf("failed to renew leases of job %d: %v", job.ID, err)
+					}
+				case <-heartbeatCtx.Done():
+					return
+				}
+			}
+		}()
+
+		for ctx.Err() == nil {
+			batch, err := f.claim(ctx, job.ID, 2*p.workers)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("failed to claim URLs of job %d: %v", job.ID, err)
+				}
+				break
+			}
+			if len(batch) == 0 {
+				remaining, err := f.remaining(ctx, job.ID)
+				if err != nil && ctx.Err() == nil {
+					log.Printf("failed to count URLs left in job %d: %v", job.ID, err)
+				}
+				if err != nil || remaining == 0 {
+					break
+				}
+				// Other workers hold URLs that may lead to more
+				sleep(ctx, claimPollInterval)
+				continue
+			}
+
+			for result := range p.process(ctx, batch, admit, work) {
+				out <- result
+			}
+		}
+
+		// URLs claimed but not started before a shutdown go back to the queue
+		if err := f.release(dbCtx, job.ID, ""); err != nil {
+			log.Printf("failed to release URLs of job %d: %v", job.ID, err)
+		}
+		done, err := f.complete(dbCtx, job.ID)
+		switch {
+		case err != nil:
+			log.Printf("failed to complete job %d: %v", job.ID, err)
+		case done:
+			log.Printf("job %d done", job.ID)
+		case ctx.Err() != nil:
+			log.Printf("job %d stopped with URLs left to crawl", job.ID)
+		}
+	}()
+	return out, nil
+}
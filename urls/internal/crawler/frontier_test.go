@@ -0,0 +1,157 @@
+package crawler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jarcoal/httpmock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateJob(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(`INSERT INTO crawl_jobs`).
+		WithArgs(JobRunning, true, `{"MaxDepth":1,"MaxPages":10,"AllowedDomains":null}`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(3, time.Now()))
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO crawl_queue`).
+		WithArgs(int64(3), pq.Array([]string{"https://example.com/", "https://example.org/"}), pq.Array([]int64{0, 0}), nil).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	job, err := NewFrontier(db, "worker-1", time.Minute).CreateJob(context.Background(), true, CrawlOptions{MaxDepth: 1, MaxPages: 10},
+		[]string{"https://example.com/", "https://example.org/"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), job.ID)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unmet expectations: %v", err)
+	}
+}
+
+func TestRunJob(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder("GET", "https://example.com/b", httpmock.NewStringResponder(200, "b"))
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(`SELECT url FROM crawl_queue`).WithArgs(int64(3)).
+		WillReturnRows(sqlmock.NewRows([]string{"url"}).AddRow("https://example.com/a").AddRow("https://example.com/b"))
+	// URLs left behind by an earlier run of this worker
+	mock.ExpectExec(`UPDATE crawl_queue SET state`).
+		WithArgs(int64(3), "worker-1", StateInProgress, StatePending, "").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	// Only the pending URL is claimed and fetched
+	mock.ExpectQuery(`UPDATE crawl_queue SET state = \$3, locked_by = \$4`).
+		WithArgs(int64(3), StatePending, StateInProgress, "worker-1", "60000 milliseconds", 2,
+			MaxAttempts, StateFailed, "gave up after 5 attempts").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "url", "depth"}).AddRow(2, "https://example.com/b", 0))
+	mock.ExpectExec(`INSERT INTO url_contents`).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`INSERT INTO url_responses`).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`UPDATE crawl_queue SET state`).
+		WithArgs(int64(3), "https://example.com/b", "worker-1", StateDone, nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	// Nothing left to claim nor held by other workers
+	mock.ExpectQuery(`UPDATE crawl_queue SET state = \$3, locked_by = \$4`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "url", "depth"}))
+	mock.ExpectQuery(`SELECT count\(\*\) FROM crawl_queue`).WithArgs(int64(3), StatePending, StateInProgress).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectExec(`UPDATE crawl_queue SET state`).
+		WithArgs(int64(3), "worker-1", StateInProgress, StatePending, "").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`UPDATE crawl_jobs SET status`).WithArgs(int64(3), JobDone, StatePending, StateInProgress).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	c := New(NewPostgresStore(db, NoCompression), Options{IgnoreRobots: true})
+	f := NewFrontier(db, "worker-1", time.Minute)
+	results, err := NewPool(1, 1).RunJob(context.Background(), c, f, &Job{ID: 3})
+	assert.NoError(t, err)
+
+	var fetched []string
+	for result := range results {
+		assert.NoError(t, result.Err)
+		fetched = append(fetched, result.URL)
+	}
+	assert.Equal(t, []string{"https://example.com/b"}, fetched)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unmet expectations: %v", err)
+	}
+}
+
+func TestRunJobCrawl(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder("GET", "https://example.com/",
+		httpmock.NewStringResponder(200, `<a href="/b">b</a>`).HeaderSet(map[string][]string{"Content-Type": {"text/html"}}))
+	httpmock.RegisterResponder("GET", "https://example.com/b", httpmock.NewStringResponder(200, "b"))
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(`SELECT url FROM crawl_queue`).WithArgs(int64(3)).
+		WillReturnRows(sqlmock.NewRows([]string{"url"}).AddRow("https://example.com/"))
+	mock.ExpectExec(`UPDATE crawl_queue SET state`).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	mock.ExpectQuery(`UPDATE crawl_queue SET state = \$3, locked_by = \$4`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "url", "depth"}).AddRow(1, "https://example.com/", 0))
+	mock.ExpectExec(`INSERT INTO url_contents`).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`INSERT INTO url_responses`).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`UPDATE crawl_queue SET state`).
+		WithArgs(int64(3), "https://example.com/", "worker-1", StateDone, nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// The discovered link goes to the frontier
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO crawl_queue`).
+		WithArgs(int64(3), pq.Array([]string{"https://example.com/b"}), pq.Array([]int64{1}), nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	// and is claimed and fetched next
+	mock.ExpectQuery(`UPDATE crawl_queue SET state = \$3, locked_by = \$4`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "url", "depth"}).AddRow(2, "https://example.com/b", 1))
+	mock.ExpectExec(`INSERT INTO url_contents`).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`INSERT INTO url_responses`).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`UPDATE crawl_queue SET state`).
+		WithArgs(int64(3), "https://example.com/b", "worker-1", StateDone, nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	mock.ExpectQuery(`UPDATE crawl_queue SET state = \$3, locked_by = \$4`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "url", "depth"}))
+	mock.ExpectQuery(`SELECT count\(\*\) FROM crawl_queue`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectExec(`UPDATE crawl_queue SET state`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`UPDATE crawl_jobs SET status`).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	c := New(NewPostgresStore(db, NoCompression), Options{IgnoreRobots: true})
+	f := NewFrontier(db, "worker-1", time.Minute)
+	results, err := NewPool(1, 1).RunJob(context.Background(), c, f, &Job{ID: 3, Crawl: true, Options: CrawlOptions{MaxDepth: 1}})
+	assert.NoError(t, err)
+
+	var fetched []string
+	for result := range results {
+		assert.NoError(t, result.Err)
+		fetched = append(fetched, result.URL)
+	}
+	assert.Equal(t, []string{"https://example.com/", "https://example.com/b"}, fetched)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unmet expectations: %v", err)
+	}
+}
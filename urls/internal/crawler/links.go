@@ -0,0 +1,74 @@
+package crawler
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// ExtractLinks parses an HTML document and returns the absolute http(s) URLs
+// of its anchors, resolved against pageURL (or the document's <base href>).
+// Fragments are dropped and each URL is returned once.
+func ExtractLinks(pageURL string, body []byte) ([]string, error) {
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := html.Parse(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	var hrefs []string
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.Data {
+			case "base":
+				if href, ok := attr(n, "href"); ok {
+					if b, err := base.Parse(href); err == nil {
+						base = b
+					}
+				}
+			case "a", "area":
+				if href, ok := attr(n, "href"); ok {
+					hrefs = append(hrefs, href)
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	seen := make(map[string]bool)
+	var links []string
+	for _, href := range hrefs {
+		u, err := base.Parse(strings.TrimSpace(href))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			continue
+		}
+		u.Fragment = ""
+		u.RawFragment = ""
+
+		link := u.String()
+		if !seen[link] {
+			seen[link] = true
+			links = append(links, link)
+		}
+	}
+	return links, nil
+}
+
+func attr(n *html.Node, key string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,251 @@
+package crawler
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Metadata is what an HTML page says about itself in its head and headings.
+type Metadata struct {
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	// Canonical is the absolute URL of <link rel="canonical">.
+	Canonical string `json:"canonical,omitempty"`
+	// Robots is the content of <meta name="robots">, e.g. "noindex, follow".
+	Robots string `json:"robots,omitempty"`
+	Lang   string `json:"lang,omitempty"`
+	// OpenGraph and Twitter hold the og:* and twitter:* meta tags, keyed
+	// without their prefix, e.g. "title" or "image". The first value of
+	// repeated properties wins.
+	OpenGraph map[string]string `json:"open_graph,omitempty"`
+	Twitter   map[string]string `json:"twitter,omitempty"`
+	// H1 and H2 are the texts of the headings in document order.
+	H1 []string `json:"h1,omitempty"`
+	H2 []string `json:"h2,omitempty"`
+	// JSONLD holds the valid <script type="application/ld+json"> blocks.
+	JSONLD []json.RawMessage `json:"json_ld,omitempty"`
+}
+
+// ExtractMetadata parses an HTML document and returns its metadata. Relative
+// canonical URLs are resolved against pageURL (or the document's <base href>).
+func ExtractMetadata(pageURL string, body []byte) (*Metadata, error) {
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := html.Parse(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Metadata{}
+	var canonical string
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.DataAtom {
+			case atom.Html:
+				m.Lang, _ = attr(n, "lang")
+			case atom.Base:
+				if href, ok := attr(n, "href"); ok {
+					if b, err := base.Parse(href); err == nil {
+						base = b
+					}
+				}
+			case atom.Title:
+				if m.Title == "" {
+					m.Title = nodeText(n)
+				}
+			case atom.Link:
+				if rel, _ := attr(n, "rel"); canonical == "" && hasToken(rel, "canonical") {
+					canonical, _ = attr(n, "href")
+				}
+			case atom.Meta:
+				m.addMeta(n)
+			case atom.H1:
+				if text := nodeText(n); text != "" {
+					m.H1 = append(m.H1, text)
+				}
+			case atom.H2:
+				if text := nodeText(n); text != "" {
+					m.H2 = append(m.H2, text)
+				}
+			case atom.Script:
+				if typ, _ := attr(n, "type"); strings.EqualFold(strings.TrimSpace(typ), "application/ld+json") {
+					m.addJSONLD(n)
+				}
+			case atom.Svg:
+				// Its <title> elements describe images, not the page
+				return
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	if canonical = strings.TrimSpace(canonical); canonical != "" {
+		if u, err := base.Parse(canonical); err == nil {
+			m.Canonical = u.String()
+		}
+	}
+	return m, nil
+}
+
+// addMeta records the <meta> tags we know about.
+func (m *Metadata) addMeta(n *html.Node) {
+	content, ok := attr(n, "content")
+	if !ok {
+		return
+	}
+	content = strings.TrimSpace(content)
+
+	// OpenGraph uses property=, Twitter name=, but both are found in the wild
+	key, ok := attr(n, "property")
+	if !ok {
+		key, _ = attr(n, "name")
+	}
+	key = strings.ToLower(strings.TrimSpace(key))
+
+	switch {
+	case key == "description":
+		if m.Description == "" {
+			m.Description = content
+		}
+	case key == "robots":
+		if m.Robots == "" {
+			m.Robots = content
+		}
+	case strings.HasPrefix(key, "og:"):
+		m.OpenGraph = setOnce(m.OpenGraph, strings.TrimPrefix(key, "og:"), content)
+	case strings.HasPrefix(key, "twitter:"):
+		m.Twitter = setOnce(m.Twitter, strings.TrimPrefix(key, "twitter:"), content)
+	}
+}
+
+// addJSONLD keeps the content of a JSON-LD script if it is valid JSON.
+func (m *Metadata) addJSONLD(n *html.Node) {
+	var b strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.TextNode {
+			b.WriteString(c.Data)
+		}
+	}
+	data := []byte(strings.TrimSpace(b.String()))
+	if len(data) == 0 || !json.Valid(data) {
+		return
+	}
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, data); err != nil {
+		return
+	}
+	m.JSONLD = append(m.JSONLD, compact.Bytes())
+}
+
+func setOnce(m map[string]string, key, value string) map[string]string {
+	if m == nil {
+		m = make(map[string]string)
+	}
+	if _, ok := m[key]; !ok && key != "" {
+		m[key] = value
+	}
+	return m
+}
+
+// nodeText returns the text inside n with whitespace collapsed.
+func nodeText(n *html.Node) string {
+	var b strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+			b.WriteByte(' ')
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// hasToken reports whether the space-separated list s contains token.
+func hasToken(s, token string) bool {
+	for _, t := range strings.Fields(s) {
+		if strings.EqualFold(t, token) {
+			return true
+		}
+	}
+	return false
+}
+
+// extractMetadata sets Metadata for HTML responses with a body in memory.
+// A page that cannot be parsed is still stored, without metadata.
+func (resp *Response) extractMetadata() {
+	if resp.Body == nil || !resp.IsHTML() {
+		return
+	}
+	m, err := ExtractMetadata(resp.FinalURL, resp.HTML())
+	if err != nil {
+		log.Printf("failed to extract metadata of URL %s: %v", resp.URL, err)
+		return
+	}
+	resp.Metadata = m
+}
+
+// columns returns the values of the url_responses metadata columns, all NULL
+// for responses without metadata.
+func (m *Metadata) columns() ([]interface{}, error) {
+	if m == nil {
+		return make([]interface{}, 9), nil
+	}
+
+	var headings interface{}
+	if len(m.H1) > 0 || len(m.H2) > 0 {
+		headings = struct {
+			H1 []string `json:"h1,omitempty"`
+			H2 []string `json:"h2,omitempty"`
+		}{m.H1, m.H2}
+	}
+	values := []interface{}{
+		nullString(m.Title), nullString(m.Description), nullString(m.Canonical), nullString(m.Robots), nullString(m.Lang),
+	}
+	for _, v := range []interface{}{m.OpenGraph, m.Twitter, headings, m.JSONLD} {
+		value, err := jsonColumn(v)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// jsonColumn encodes v for a JSONB column, mapping empty values to NULL.
+func jsonColumn(v interface{}) (sql.NullString, error) {
+	switch v := v.(type) {
+	case nil:
+		return sql.NullString{}, nil
+	case map[string]string:
+		if len(v) == 0 {
+			return sql.NullString{}, nil
+		}
+	case []json.RawMessage:
+		if len(v) == 0 {
+			return sql.NullString{}, nil
+		}
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+	return sql.NullString{String: string(data), Valid: true}, nil
+}
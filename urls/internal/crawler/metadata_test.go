@@ -0,0 +1,89 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const metadataPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <title> Pricing |
+    Example </title>
+  <base href="https://example.com/en/">
+  <meta name="description" content="Plans and prices">
+  <meta name="robots" content="noindex, follow">
+  <meta property="og:title" content="Pricing">
+  <meta property="og:image" content="https://example.com/a.png">
+  <meta property="og:image" content="https://example.com/b.png">
+  <meta name="twitter:card" content="summary">
+  <link rel="alternate canonical" href="pricing?ref=head">
+  <script type="application/ld+json">{ "@type": "Product",
+    "name": "Pro" }</script>
+  <script type="application/ld+json">{ not json</script>
+</head>
+<body>
+  <svg><title>Logo</title></svg>
+  <h1>Plans <em>and</em> prices</h1>
+  <h2>Basic</h2>
+  <h2>Pro</h2>
+  <h2> </h2>
+</body>
+</html>`
+
+func TestExtractMetadata(t *testing.T) {
+	m, err := ExtractMetadata("https://example.com/pricing", []byte(metadataPage))
+
+	require.NoError(t, err)
+	assert.Equal(t, &Metadata{
+		Title:       "Pricing | Example",
+		Description: "Plans and prices",
+		Canonical:   "https://example.com/en/pricing?ref=head",
+		Robots:      "noindex, follow",
+		Lang:        "en",
+		OpenGraph:   map[string]string{"title": "Pricing", "image": "https://example.com/a.png"},
+		Twitter:     map[string]string{"card": "summary"},
+		H1:          []string{"Plans and prices"},
+		H2:          []string{"Basic", "Pro"},
+		JSONLD:      []json.RawMessage{json.RawMessage(`{"@type":"Product","name":"Pro"}`)},
+	}, m)
+}
+
+func TestSaveResponseMetadata(t *testing.T) {
+	ctx := context.Background()
+	store, err := OpenSQLiteStore(filepath.Join(t.TempDir(), "urls.db"), NoCompression)
+	require.NoError(t, err)
+	defer store.Close()
+
+	resp := &Response{
+		URL: "https://example.com/pricing", FinalURL: "https://example.com/pricing", StatusCode: 200,
+		ContentType: "text/html", FetchedAt: time.Now().UTC(), Body: []byte(metadataPage),
+	}
+	resp.extractMetadata()
+	require.NoError(t, store.SaveResponse(ctx, resp))
+
+	// Responses without metadata leave the columns NULL
+	require.NoError(t, store.SaveResponse(ctx, &Response{
+		URL: "https://example.com/data.json", FinalURL: "https://example.com/data.json", StatusCode: 200,
+		ContentType: "application/json", FetchedAt: time.Now().UTC(), Body: []byte(`{}`),
+	}))
+
+	var title, canonical, openGraph, headings string
+	err = store.DB().QueryRow(`SELECT title, canonical_url, open_graph, headings FROM url_responses WHERE id = 1`).
+		Scan(&title, &canonical, &openGraph, &headings)
+	require.NoError(t, err)
+	assert.Equal(t, "Pricing | Example", title)
+	assert.Equal(t, "https://example.com/en/pricing?ref=head", canonical)
+	assert.JSONEq(t, `{"title":"Pricing","image":"https://example.com/a.png"}`, openGraph)
+	assert.JSONEq(t, `{"h1":["Plans and prices"],"h2":["Basic","Pro"]}`, headings)
+
+	var count int
+	require.NoError(t, store.DB().QueryRow(`SELECT count(*) FROM url_responses WHERE title IS NULL AND json_ld IS NULL`).Scan(&count))
+	assert.Equal(t, 1, count)
+}
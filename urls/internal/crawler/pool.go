@@ -0,0 +1,351 @@
+package crawler
+
+import (
+	"context"
+	"log"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"url.com/data/internal/metrics"
+)
+
+// Result is the outcome of crawling a single URL.
+type Result struct {
+	URL string
+	Err error
+
+	// StatusCode, Bytes and Attempts describe the last HTTP exchange, when
+	// there was one. Duration covers fetching and storing the URL.
+	StatusCode int
+	Bytes      int64
+	Duration   time.Duration
+	Attempts   int
+	// FinalURL is the URL that answered after following redirects, and
+	// CertNotAfter when the first certificate of its server's chain expires,
+	// for HTTPS URLs.
+	FinalURL     string
+	CertNotAfter time.Time
+}
+
+// HostLimiter caps the number of concurrent requests sent to a single host.
+type HostLimiter struct {
+	limit int
+
+	mu   sync.Mutex
+	busy map[string]int
+	// freed is closed, and replaced, whenever a slot is released
+	freed chan struct{}
+}
+
+// NewHostLimiter returns a limiter allowing at most limit concurrent requests
+// per host. A limit of zero or less disables the cap.
+func NewHostLimiter(limit int) *HostLimiter {
+	return &HostLimiter{limit: limit, busy: make(map[string]int), freed: make(chan struct{})}
+}
+
+// Acquire blocks until a slot for the host of rawURL is free or ctx is done,
+// and returns the function that releases the slot.
+func (l *HostLimiter) Acquire(ctx context.Context, rawURL string) (func(), error) {
+	host := hostOf(rawURL)
+	for {
+		release, freed := l.tryAcquire(host)
+		if release != nil {
+			return release, nil
+		}
+		select {
+		case <-freed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// tryAcquire takes a slot for host when one is free. Otherwise it returns a
+// channel that is closed once a slot of any host is released.
+func (l *HostLimiter) tryAcquire(host string) (func(), <-chan struct{}) {
+	if l == nil || l.limit <= 0 {
+		return func() {}, nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.busy[host] >= l.limit {
+		return nil, l.freed
+	}
+	l.busy[host]++
+	return func() { l.release(host) }, nil
+}
+
+func (l *HostLimiter) release(host string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.busy[host]--; l.busy[host] <= 0 {
+		delete(l.busy, host)
+	}
+	close(l.freed)
+	l.freed = make(chan struct{})
+}
+
+// hostOf returns the lower-cased host of rawURL, or rawURL itself when it
+// cannot be parsed so that bad input still gets a (shared) slot.
+func hostOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return rawURL
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// Pool runs crawl jobs on a fixed number of workers, shared by all the runs
+// started on it at the same time.
+type Pool struct {
+	workers int
+	// busy counts the tasks being handled across runs, all under one key
+	busy    *HostLimiter
+	hosts   *HostLimiter
+	grace   time.Duration
+	metrics *metrics.Metrics
+}
+
+// NewPool returns a pool with the given number of workers and per-host
+// concurrency cap.
+func NewPool(workers, perHost int) *Pool {
+	if workers < 1 {
+		workers = 1
+	}
+	return &Pool{workers: workers, busy: NewHostLimiter(workers), hosts: NewHostLimiter(perHost)}
+}
+
+// SetGracePeriod sets how long in-flight jobs may keep running once the
+// context passed to Run or Crawl is done. By default they are cancelled
+// right away.
+func (p *Pool) SetGracePeriod(d time.Duration) {
+	p.grace = d
+}
+
+// SetMetrics makes the pool report the depth of its queues to m.
+func (p *Pool) SetMetrics(m *metrics.Metrics) {
+	p.metrics = m
+}
+
+// task is a single URL to crawl, along with how many links away from a seed
+// URL it was found.
+type task struct {
+	url   string
+	depth int
+}
+
+// dispatched is a task handed to a worker along with the release of its
+// host slot, and of the worker.
+type dispatched struct {
+	task
+	release       func()
+	releaseWorker func()
+}
+
+// hostQueue holds the tasks waiting for a worker by host, so that the tasks
+// of hosts with a free slot are not held up behind those of a busy one.
+// Tasks of a host keep their order, and hosts are tried in the order they
+// were queued.
+type hostQueue struct {
+	hosts []string
+	tasks map[string][]task
+	size  int
+}
+
+func (q *hostQueue) push(tasks []task) {
+	if q.tasks == nil {
+		q.tasks = make(map[string][]task)
+	}
+	for _, t := range tasks {
+		host := hostOf(t.url)
+		if len(q.tasks[host]) == 0 {
+			q.hosts = append(q.hosts, host)
+		}
+		q.tasks[host] = append(q.tasks[host], t)
+	}
+	q.size += len(tasks)
+}
+
+// next removes the first task whose host has a free slot in l and returns
+// it along with the release of the slot. When every host is busy it returns
+// a channel that is closed once a slot is released instead.
+func (q *hostQueue) next(l *HostLimiter) (dispatched, <-chan struct{}) {
+	var freed <-chan struct{}
+	for i, host := range q.hosts {
+		release, wait := l.tryAcquire(host)
+		if release == nil {
+			// The first channel is closed by any release after it
+			if freed == nil {
+				freed = wait
+			}
+			continue
+		}
+
+		t := q.tasks[host][0]
+		if q.tasks[host] = q.tasks[host][1:]; len(q.tasks[host]) == 0 {
+			delete(q.tasks, host)
+			q.hosts = append(q.hosts[:i], q.hosts[i+1:]...)
+		}
+		q.size--
+		return dispatched{task: t, release: release}, nil
+	}
+	return dispatched{}, freed
+}
+
+// taskDone carries a finished task and the tasks it discovered back to the
+// dispatcher.
+type taskDone struct {
+	task          task
+	found         []task
+	result        Result
+	releaseWorker func()
+}
+
+// Run calls do for every URL and sends one Result per URL on the returned
+// channel, which is closed once all URLs have been processed. When ctx is done
+// no further URLs are started.
+func (p *Pool) Run(ctx context.Context, urls []string, do func(ctx context.Context, url string) error) <-chan Result {
+	seeds := make([]task, 0, len(urls))
+	for _, u := range urls {
+		seeds = append(seeds, task{url: u})
+	}
+
+	return p.process(ctx, seeds, nil, func(ctx context.Context, t task) ([]task, Result) {
+		return nil, Result{URL: t.url, Err: do(ctx, t.url)}
+	})
+}
+
+// Fetch fetches and stores every URL with c, like Run with c.Do, but the
+// Results also describe the HTTP exchange.
+func (p *Pool) Fetch(ctx context.Context, c *Crawler, urls []string) <-chan Result {
+	seeds := make([]task, 0, len(urls))
+	for _, u := range urls {
+		seeds = append(seeds, task{url: u})
+	}
+
+	return p.process(ctx, seeds, nil, func(ctx context.Context, t task) ([]task, Result) {
+		return nil, c.Visit(ctx, t.url)
+	})
+}
+
+// workContext returns the context in-flight jobs run with: it is cancelled
+// once the grace period is over after ctx is done, or when finished is
+// closed.
+func (p *Pool) workContext(ctx context.Context, finished <-chan struct{}) context.Context {
+	workCtx, cancelWork := context.WithCancel(context.WithoutCancel(ctx))
+	go func() {
+		defer cancelWork()
+		select {
+		case <-ctx.Done():
+			timer := time.NewTimer(p.grace)
+			defer timer.Stop()
+			select {
+			case <-timer.C:
+				log.Printf("grace period of %v over, cancelling in-flight URLs", p.grace)
+			case <-finished:
+			}
+		case <-finished:
+		}
+	}()
+	return workCtx
+}
+
+// process dispatches tasks to the workers until the queue is drained or ctx
+// is done. The seeds are queued as given, and the tasks returned by handle
+// are queued as well. When admit is set, it is called from a single
+// goroutine with the tasks found by handle and returns the ones to queue.
+// Once ctx is done admit is still called for the tasks found by in-flight
+// handlers, but nothing new is dispatched.
+//
+// Tasks are only handed to a worker once one of the pool's workers is free
+// and their host has a free slot, the others wait in the queue meanwhile.
+//
+// handle is given a context that outlives ctx by the pool's grace period, so
+// that in-flight tasks can finish cleanly on shutdown.
+func (p *Pool) process(ctx context.Context, seeds []task, admit func([]task) []task, handle func(context.Context, task) ([]task, Result)) <-chan Result {
+	jobs := make(chan dispatched)
+	done := make(chan taskDone)
+	results := make(chan Result, p.workers)
+
+	finished := make(chan struct{})
+	workCtx := p.workContext(ctx, finished)
+
+	var wg sync.WaitGroup
+	for i := 0; i < p.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for d := range jobs {
+				found, result := handle(workCtx, d.task)
+				d.release()
+				done <- taskDone{task: d.task, found: found, result: result, releaseWorker: d.releaseWorker}
+			}
+		}()
+	}
+
+	go func() {
+		var queue hostQueue
+		stopped := false
+		enqueue := func(tasks []task) {
+			if !stopped {
+				queue.push(tasks)
+				p.metrics.Queued(len(tasks))
+			}
+		}
+		enqueue(seeds)
+
+		inFlight := 0
+		stopping := ctx.Done()
+		for queue.size > 0 || inFlight > 0 {
+			// Wait for a worker of the pool, which other runs may hold, and
+			// for a host slot. A nil channel blocks forever.
+			var freed <-chan struct{}
+			if queue.size > 0 && ctx.Err() == nil {
+				releaseWorker, wait := p.busy.tryAcquire("")
+				freed = wait
+				if releaseWorker != nil {
+					next, wait := queue.next(p.hosts)
+					if next.release != nil {
+						// Workers of this run are only released once their
+						// task is done, so one of them is idle
+						next.releaseWorker = releaseWorker
+						jobs <- next
+						p.metrics.Queued(-1)
+						inFlight++
+						continue
+					}
+					releaseWorker()
+					freed = wait
+				}
+			}
+
+			select {
+			case <-freed:
+			case d := <-done:
+				d.releaseWorker()
+				inFlight--
+				results <- d.result
+				if admit != nil && len(d.found) > 0 {
+					d.found = admit(d.found)
+				}
+				enqueue(d.found)
+			case <-stopping:
+				// Drop everything not started yet and wait for in-flight tasks
+				stopping = nil
+				stopped = true
+				p.metrics.Queued(-queue.size)
+				queue = hostQueue{}
+			}
+		}
+
+		close(jobs)
+		wg.Wait()
+		close(finished)
+		close(results)
+	}()
+
+	return results
+}
@@ -0,0 +1,186 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPoolRun(t *testing.T) {
+	var urls []string
+	for i := 0; i < 20; i++ {
+		urls = append(urls, fmt.Sprintf("https://example.com/%d", i))
+		urls = append(urls, fmt.Sprintf("https://example.org/%d", i))
+	}
+
+	var (
+		mu      sync.Mutex
+		inHost  = map[string]int{}
+		maxHost = map[string]int{}
+		running int32
+		maxRun  int32
+	)
+
+	pool := NewPool(4, 2)
+	results := pool.Run(context.Background(), urls, func(ctx context.Context, url string) error {
+		host := hostOf(url)
+		mu.Lock()
+		inHost[host]++
+		if inHost[host] > maxHost[host] {
+			maxHost[host] = inHost[host]
+		}
+		mu.Unlock()
+
+		n := atomic.AddInt32(&running, 1)
+		for {
+			m := atomic.LoadInt32(&maxRun)
+			if n <= m || atomic.CompareAndSwapInt32(&maxRun, m, n) {
+				break
+			}
+		}
+
+		time.Sleep(time.Millisecond)
+
+		atomic.AddInt32(&running, -1)
+		mu.Lock()
+		inHost[host]--
+		mu.Unlock()
+		return nil
+	})
+
+	count := 0
+	for result := range results {
+		assert.NoError(t, result.Err)
+		count++
+	}
+
+	assert.Equal(t, len(urls), count)
+	assert.LessOrEqual(t, int(maxRun), 4)
+	assert.LessOrEqual(t, maxHost["example.com"], 2)
+	assert.LessOrEqual(t, maxHost["example.org"], 2)
+}
+
+func TestPoolRunGroupedHosts(t *testing.T) {
+	// All the URLs of a host come before those of the other
+	var urls []string
+	for _, host := range []string{"a.example.com", "b.example.com"} {
+		for i := 0; i < 10; i++ {
+			urls = append(urls, fmt.Sprintf("https://%s/%d", host, i))
+		}
+	}
+
+	var running, maxRun, aDone int32
+	bStarted := int32(-1)
+	results := NewPool(4, 1).Run(context.Background(), urls, func(ctx context.Context, url string) error {
+		if url == "https://b.example.com/0" {
+			atomic.StoreInt32(&bStarted, atomic.LoadInt32(&aDone))
+		}
+		n := atomic.AddInt32(&running, 1)
+		for {
+			m := atomic.LoadInt32(&maxRun)
+			if n <= m || atomic.CompareAndSwapInt32(&maxRun, m, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		if hostOf(url) == "a.example.com" {
+			atomic.AddInt32(&aDone, 1)
+		}
+		return nil
+	})
+	for range results {
+	}
+
+	// Workers waiting on the busy host do not hold up the other one
+	assert.Equal(t, int32(2), maxRun)
+	assert.Equal(t, int32(0), bStarted)
+}
+
+func TestPoolSharedWorkers(t *testing.T) {
+	var running, maxRun int32
+	do := func(ctx context.Context, url string) error {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			m := atomic.LoadInt32(&maxRun)
+			if n <= m || atomic.CompareAndSwapInt32(&maxRun, m, n) {
+				break
+			}
+		}
+		time.Sleep(2 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		return nil
+	}
+
+	// Runs at the same time, e.g. jobs of the API, share the workers
+	pool := NewPool(2, 0)
+	var wg sync.WaitGroup
+	for run := 0; run < 3; run++ {
+		var urls []string
+		for i := 0; i < 10; i++ {
+			urls = append(urls, fmt.Sprintf("https://example%d.com/%d", run, i))
+		}
+		results := pool.Run(context.Background(), urls, do)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			count := 0
+			for range results {
+				count++
+			}
+			assert.Equal(t, len(urls), count)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(2), maxRun)
+}
+
+func TestHostLimiterAcquire(t *testing.T) {
+	l := NewHostLimiter(1)
+	release, err := l.Acquire(context.Background(), "https://example.com/a")
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = l.Acquire(ctx, "https://example.com/b")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// Other hosts have slots of their own
+	other, err := l.Acquire(context.Background(), "https://example.org/")
+	assert.NoError(t, err)
+	other()
+
+	go release()
+	release, err = l.Acquire(context.Background(), "https://example.com/b")
+	assert.NoError(t, err)
+	release()
+}
+
+func TestPoolRunCancel(t *testing.T) {
+	var urls []string
+	for i := 0; i < 10; i++ {
+		urls = append(urls, fmt.Sprintf("https://example.com/%d", i))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	pool := NewPool(1, 1)
+	pool.SetGracePeriod(time.Second)
+	results := pool.Run(ctx, urls, func(ctx context.Context, url string) error {
+		// Cancelling stops dispatch but the in-flight URL keeps its context
+		cancel()
+		time.Sleep(10 * time.Millisecond)
+		return ctx.Err()
+	})
+
+	count := 0
+	for result := range results {
+		assert.NoError(t, result.Err)
+		count++
+	}
+	assert.Equal(t, 1, count)
+}
@@ -0,0 +1,92 @@
+package crawler
+
+import (
+	"mime"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"url.com/data/internal/extract"
+)
+
+// Response is a fetched URL along with the details of the HTTP exchange.
+type Response struct {
+	// URL is the URL that was requested and FinalURL the one that answered
+	// after following redirects.
+	URL      string
+	FinalURL string
+
+	StatusCode  int
+	Header      http.Header
+	ContentType string
+
+	// ContentLength is the number of body bytes read and Hash their SHA-256.
+	ContentLength int64
+	Hash          string
+	// Body holds the body unless it was too large to keep in memory, in
+	// which case it is spooled to a temporary file until the Response is
+	// closed.
+	Body      []byte
+	spool     *os.File
+	Truncated bool
+	// Text is the body decoded from Charset to UTF-8, for textual content
+	// types kept in memory.
+	Text    string
+	Charset string
+
+	// ETag and LastModified are the validators used to revalidate the
+	// response on the next run.
+	ETag         string
+	LastModified string
+	// Unchanged is set when the server answered 304 Not Modified, and points
+	// at the stored snapshot that was revalidated.
+	Unchanged *Snapshot
+	// Metadata is parsed from HTML responses with a body in memory.
+	Metadata *Metadata
+	// TLS describes the connection of HTTPS responses.
+	TLS *TLSInfo
+	// Extracted holds the values of the Options.Rules matching the URL, and
+	// JobID the crawl job they were fetched for, if any.
+	Extracted []extract.Value
+	JobID     int64
+
+	// Duration covers the last attempt, from sending the request until the
+	// body was read.
+	Duration  time.Duration
+	FetchedAt time.Time
+	Attempts  int
+
+	// StatusErr classifies a non-2xx response that was kept to be stored;
+	// the URL still counts as failed. nil for 2xx and 304 responses.
+	StatusErr *FetchError
+}
+
+// MediaType returns the media type of the response without parameters, e.g.
+// "text/html". It is sniffed from the body when the server did not send one.
+func (r *Response) MediaType() string {
+	contentType := r.ContentType
+	if contentType == "" {
+		contentType = http.DetectContentType(r.Body)
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	}
+	return mediaType
+}
+
+// IsHTML reports whether the response is an HTML document.
+func (r *Response) IsHTML() bool {
+	mediaType := r.MediaType()
+	return mediaType == "text/html" || mediaType == "application/xhtml+xml"
+}
+
+// HTML returns the document to parse: the decoded text when there is one,
+// the raw body otherwise.
+func (r *Response) HTML() []byte {
+	if r.Charset != "" {
+		return []byte(r.Text)
+	}
+	return r.Body
+}
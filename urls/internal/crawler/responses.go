@@ -0,0 +1,137 @@
+package crawler
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// DefaultResponsesLimit is how many responses Responses returns when the
+// filter sets no limit, and MaxResponsesLimit the most it returns at once.
+const (
+	DefaultResponsesLimit = 100
+	MaxResponsesLimit     = 1000
+)
+
+// ResponseFilter selects stored responses. Zero fields match everything.
+type ResponseFilter struct {
+	JobID int64
+	// URLPrefix matches the requested URL.
+	URLPrefix string
+	// StatusClass matches status codes from StatusClass*100 to
+	// StatusClass*100+99, e.g. 4 for client errors. StatusCode takes
+	// precedence.
+	StatusClass int
+	StatusCode  int
+	// ContentType matches the media type, ignoring parameters.
+	ContentType string
+	Since       time.Time
+	Until       time.Time
+	// AfterID pages through the results: responses are ordered by id and
+	// only those after AfterID are returned.
+	AfterID int64
+	Limit   int
+}
+
+// StoredResponse describes a stored response, without its body.
+type StoredResponse struct {
+	ID            int64     `json:"id"`
+	JobID         int64     `json:"job_id,omitempty"`
+	URL           string    `json:"url"`
+	FinalURL      string    `json:"final_url"`
+	StatusCode    int       `json:"status_code"`
+	ContentType   string    `json:"content_type,omitempty"`
+	ContentLength int64     `json:"content_length"`
+	ContentHash   string    `json:"content_hash,omitempty"`
+	DurationMs    int64     `json:"fetch_duration_ms"`
+	FetchedAt     time.Time `json:"fetched_at"`
+	UnchangedFrom int64     `json:"unchanged_from,omitempty"`
+	Truncated     bool      `json:"truncated,omitempty"`
+	Title         string    `json:"title,omitempty"`
+}
+
+// likeEscaper escapes the wildcards of a LIKE pattern, with ESCAPE '\'.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// Responses returns the stored responses matching filter, ordered by id.
+func (s *SQLStore) Responses(ctx context.Context, filter ResponseFilter) ([]StoredResponse, error) {
+	var conds []string
+	var args []interface{}
+	where := func(cond string, values ...interface{}) {
+		for _, v := range values {
+			args = append(args, v)
+			cond = strings.Replace(cond, "?", fmt.Sprintf("$%d", len(args)), 1)
+		}
+		conds = append(conds, cond)
+	}
+
+	if filter.JobID != 0 {
+		where("job_id = ?", filter.JobID)
+	}
+	if filter.URLPrefix != "" {
+		// substr counts characters, not bytes
+		where("substr(url, 1, ?) = ?", utf8.RuneCountInString(filter.URLPrefix), filter.URLPrefix)
+	}
+	switch {
+	case filter.StatusCode != 0:
+		where("status_code = ?", filter.StatusCode)
+	case filter.StatusClass != 0:
+		where("status_code BETWEEN ? AND ?", filter.StatusClass*100, filter.StatusClass*100+99)
+	}
+	if filter.ContentType != "" {
+		contentType := strings.ToLower(filter.ContentType)
+		where(`(lower(content_type) = ? OR lower(content_type) LIKE ? ESCAPE '\')`, contentType, likeEscaper.Replace(contentType)+";%")
+	}
+	if !filter.Since.IsZero() {
+		where("fetched_at >= ?", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		where("fetched_at < ?", filter.Until)
+	}
+	if filter.AfterID != 0 {
+		where("id > ?", filter.AfterID)
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = DefaultResponsesLimit
+	}
+	if limit > MaxResponsesLimit {
+		limit = MaxResponsesLimit
+	}
+	args = append(args, limit)
+
+	query := `
+		SELECT id, COALESCE(job_id, 0), url, COALESCE(final_url, url), COALESCE(status_code, 0), COALESCE(content_type, ''),
+		       COALESCE(content_length, 0), COALESCE(content_hash, ''), COALESCE(fetch_duration_ms, 0), fetched_at,
+		       COALESCE(unchanged_from, 0), truncated, COALESCE(title, '')
+		FROM url_responses`
+	if len(conds) > 0 {
+		query += "\n\t\tWHERE " + strings.Join(conds, " AND ")
+	}
+	query += fmt.Sprintf("\n\t\tORDER BY id\n\t\tLIMIT $%d", len(args))
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	responses := []StoredResponse{}
+	for rows.Next() {
+		var r StoredResponse
+		var fetchedAt sql.NullTime
+		err := rows.Scan(&r.ID, &r.JobID, &r.URL, &r.FinalURL, &r.StatusCode, &r.ContentType,
+			&r.ContentLength, &r.ContentHash, &r.DurationMs, &fetchedAt,
+			&r.UnchangedFrom, &r.Truncated, &r.Title)
+		if err != nil {
+			return nil, err
+		}
+		r.FetchedAt = fetchedAt.Time
+		responses = append(responses, r)
+	}
+	return responses, rows.Err()
+}
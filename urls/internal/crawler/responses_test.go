@@ -0,0 +1,51 @@
+package crawler
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResponsesURLPrefix(t *testing.T) {
+	ctx := context.Background()
+	store, err := OpenSQLiteStore(filepath.Join(t.TempDir(), "urls.db"), NoCompression)
+	require.NoError(t, err)
+	defer store.Close()
+
+	for _, url := range []string{"https://example.com/café/menu", "https://example.com/cafe/menu", "https://example.com/cafés"} {
+		require.NoError(t, store.SaveResponse(ctx, &Response{
+			URL: url, FinalURL: url, StatusCode: 200, FetchedAt: time.Now().UTC(),
+			Body: []byte("menu"), ContentLength: 4,
+		}))
+	}
+
+	// The prefix is compared in characters, not bytes
+	responses, err := store.Responses(ctx, ResponseFilter{URLPrefix: "https://example.com/café/"})
+	require.NoError(t, err)
+	require.Len(t, responses, 1)
+	assert.Equal(t, "https://example.com/café/menu", responses[0].URL)
+}
+
+func TestResponsesContentType(t *testing.T) {
+	ctx := context.Background()
+	store, err := OpenSQLiteStore(filepath.Join(t.TempDir(), "urls.db"), NoCompression)
+	require.NoError(t, err)
+	defer store.Close()
+
+	for url, contentType := range map[string]string{"https://example.com/": "text/html; charset=utf-8", "https://example.com/feed": "application/rss+xml"} {
+		require.NoError(t, store.SaveResponse(ctx, &Response{
+			URL: url, FinalURL: url, StatusCode: 200, ContentType: contentType, FetchedAt: time.Now().UTC(),
+			Body: []byte(url), ContentLength: int64(len(url)),
+		}))
+	}
+
+	for contentType, expected := range map[string]int{"TEXT/HTML": 1, "application/rss+xml": 1, "text_html": 0, "%": 0} {
+		responses, err := store.Responses(ctx, ResponseFilter{ContentType: contentType})
+		require.NoError(t, err)
+		assert.Len(t, responses, expected, contentType)
+	}
+}
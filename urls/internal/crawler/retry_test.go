@@ -0,0 +1,151 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+	"url.com/data/internal/metrics"
+)
+
+func TestFetchURLRetries(t *testing.T) {
+	policy := RetryPolicy{MaxRetries: 2, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond}
+
+	tests := []struct {
+		name          string
+		responses     []*http.Response
+		expectedKind  ErrorKind
+		expectedCalls int
+	}{
+		{
+			name: "Recovers after transient failures",
+			responses: []*http.Response{
+				httpmock.NewStringResponse(500, ""),
+				httpmock.NewStringResponse(502, ""),
+				httpmock.NewStringResponse(200, "ok"),
+			},
+			expectedCalls: 3,
+		},
+		{
+			name: "Gives up after max retries",
+			responses: []*http.Response{
+				httpmock.NewStringResponse(429, ""),
+				httpmock.NewStringResponse(504, ""),
+				httpmock.NewStringResponse(503, ""),
+			},
+			expectedKind:  Transient,
+			expectedCalls: 3,
+		},
+		{
+			name: "Gives up when Retry-After exceeds max delay",
+			responses: []*http.Response{
+				func() *http.Response {
+					resp := httpmock.NewStringResponse(503, "")
+					resp.Header.Set("Retry-After", "120")
+					return resp
+				}(),
+			},
+			expectedKind:  Transient,
+			expectedCalls: 1,
+		},
+	}
+
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			httpmock.Reset()
+			calls := 0
+			httpmock.RegisterResponder("GET", "https://example.com/page",
+				func(req *http.Request) (*http.Response, error) {
+					resp := testCase.responses[calls]
+					calls++
+					return resp, nil
+				})
+
+			c := New(nil, Options{IgnoreRobots: true, Retry: policy})
+			_, err := c.FetchURL(context.Background(), "https://example.com/page")
+
+			assert.Equal(t, testCase.expectedCalls, calls)
+			if testCase.expectedKind == 0 {
+				assert.NoError(t, err)
+				return
+			}
+
+			var fetchErr *FetchError
+			if assert.True(t, errors.As(err, &fetchErr)) {
+				assert.Equal(t, testCase.expectedKind, fetchErr.Kind)
+				assert.Equal(t, testCase.expectedCalls, fetchErr.Attempts)
+			}
+		})
+	}
+}
+
+func TestPermanentServerErrors(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	c := New(nil, Options{IgnoreRobots: true, FailOnStatus: true, Retry: RetryPolicy{MaxRetries: 2, BaseDelay: time.Millisecond}})
+
+	for _, code := range []int{http.StatusNotImplemented, http.StatusHTTPVersionNotSupported} {
+		httpmock.Reset()
+		httpmock.RegisterResponder("GET", "https://example.com/page", httpmock.NewStringResponder(code, ""))
+
+		_, err := c.FetchURL(context.Background(), "https://example.com/page")
+		assert.Equal(t, Permanent, KindOf(err), code)
+		assert.Equal(t, 1, httpmock.GetTotalCallCount(), code)
+	}
+}
+
+func TestTransportErrorKind(t *testing.T) {
+	c := New(nil, Options{IgnoreRobots: true, Retry: RetryPolicy{MaxRetries: 3}})
+
+	_, err := c.FetchURL(context.Background(), "ftp://example.com/file")
+	assert.Equal(t, Permanent, KindOf(err))
+}
+
+func TestBackoff(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+
+	for retry, max := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 3: 400 * time.Millisecond, 6: time.Second} {
+		delay := policy.backoff(retry)
+		assert.GreaterOrEqual(t, delay, max/2)
+		assert.LessOrEqual(t, delay, max)
+	}
+
+	// Without MaxDelay the backoff keeps doubling
+	uncapped := RetryPolicy{BaseDelay: 100 * time.Millisecond}
+	for retry, max := range map[int]time.Duration{1: 100 * time.Millisecond, 4: 800 * time.Millisecond, 8: 12800 * time.Millisecond} {
+		delay := uncapped.backoff(retry)
+		assert.GreaterOrEqual(t, delay, max/2)
+		assert.LessOrEqual(t, delay, max)
+	}
+}
+
+func TestFetchURLMetrics(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	calls := 0
+	httpmock.RegisterResponder("GET", "https://example.com/page",
+		func(req *http.Request) (*http.Response, error) {
+			calls++
+			if calls == 1 {
+				return httpmock.NewStringResponse(503, ""), nil
+			}
+			return httpmock.NewStringResponse(200, "ok"), nil
+		})
+
+	m := metrics.New()
+	c := New(nil, Options{IgnoreRobots: true, Retry: RetryPolicy{MaxRetries: 1, BaseDelay: time.Millisecond}, Metrics: m})
+	_, err := c.FetchURL(context.Background(), "https://example.com/page")
+	assert.NoError(t, err)
+
+	var summary strings.Builder
+	assert.NoError(t, m.WriteSummary(&summary))
+	assert.Contains(t, summary.String(), "Fetches = 2 from 1 hosts (2xx = 1, 5xx = 1), Retries = 1, Downloaded = 2 bytes")
+}
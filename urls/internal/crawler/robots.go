@@ -0,0 +1,301 @@
+package crawler
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrDisallowed is returned for URLs that robots.txt does not allow us to fetch.
+var ErrDisallowed = errors.New("disallowed by robots.txt")
+
+// maxRobotsSize is the amount of robots.txt that is parsed, as suggested by RFC 9309.
+const maxRobotsSize = 500 << 10
+
+// Robots fetches and caches robots.txt per host and enforces its rules and
+// Crawl-delay for a single user agent.
+type Robots struct {
+	client    *http.Client
+	userAgent string
+
+	mu    sync.Mutex
+	hosts map[string]*robotsHost
+}
+
+type robotsHost struct {
+	once  sync.Once
+	rules *robotsRules
+
+	// mu serialises requests to the host while a Crawl-delay applies
+	mu   sync.Mutex
+	last time.Time
+}
+
+// NewRobots returns a robots.txt cache that fetches with client and evaluates
+// rules for userAgent.
+func NewRobots(client *http.Client, userAgent string) *Robots {
+	return &Robots{client: client, userAgent: userAgent, hosts: make(map[string]*robotsHost)}
+}
+
+// Check returns an error wrapping ErrDisallowed if rawURL may not be fetched.
+// Otherwise it blocks until the host's Crawl-delay has passed since the
+// previous request, or ctx is done.
+func (r *Robots) Check(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	if u.Path == "/robots.txt" {
+		return nil
+	}
+
+	h := r.host(ctx, u)
+	if !h.rules.allowed(u.EscapedPath(), u.RawQuery) {
+		return fmt.Errorf("%w: %s", ErrDisallowed, rawURL)
+	}
+
+	if h.rules.delay > 0 {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if err := sleep(ctx, time.Until(h.last.Add(h.rules.delay))); err != nil {
+			return err
+		}
+		h.last = time.Now()
+	}
+	return nil
+}
+
+func (r *Robots) host(ctx context.Context, u *url.URL) *robotsHost {
+	key := strings.ToLower(u.Scheme + "://" + u.Host)
+
+	r.mu.Lock()
+	h, ok := r.hosts[key]
+	if !ok {
+		h = &robotsHost{}
+		r.hosts[key] = h
+	}
+	r.mu.Unlock()
+
+	h.once.Do(func() {
+		// Cached for every later caller, so it must not fail because the
+		// first caller was cancelled
+		h.rules = r.fetch(context.WithoutCancel(ctx), key+"/robots.txt")
+	})
+	return h
+}
+
+// Sitemaps returns the sitemap URLs listed in the robots.txt of rawURL's
+// host.
+func (r *Robots) Sitemaps(ctx context.Context, rawURL string) ([]string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return r.host(ctx, u).rules.sitemaps, nil
+}
+
+// fetch downloads and parses a robots.txt. Following RFC 9309, a missing file
+// allows everything while an unreachable one disallows everything.
+func (r *Robots) fetch(ctx context.Context, robotsURL string) *robotsRules {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, robotsURL, nil)
+	if err != nil {
+		return disallowAll()
+	}
+	req.Header.Set("User-Agent", r.userAgent)
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		log.Printf("failed to fetch %s, disallowing host: %v", robotsURL, err)
+		return disallowAll()
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 500:
+		log.Printf("failed to fetch %s, disallowing host: status %d", robotsURL, resp.StatusCode)
+		return disallowAll()
+	case resp.StatusCode >= 400:
+		return &robotsRules{}
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxRobotsSize))
+	if err != nil {
+		log.Printf("failed to read %s, disallowing host: %v", robotsURL, err)
+		return disallowAll()
+	}
+	return parseRobots(body, r.userAgent)
+}
+
+// robotsRules are the rules of the robots.txt group that applies to us.
+type robotsRules struct {
+	rules []robotsRule
+	delay time.Duration
+	// sitemaps are listed outside groups and apply to every user agent
+	sitemaps []string
+}
+
+type robotsRule struct {
+	allow   bool
+	length  int
+	pattern *regexp.Regexp
+}
+
+func disallowAll() *robotsRules {
+	return &robotsRules{rules: []robotsRule{newRobotsRule(false, "/")}}
+}
+
+func newRobotsRule(allow bool, path string) robotsRule {
+	anchored := strings.HasSuffix(path, "$")
+	parts := strings.Split(strings.TrimSuffix(path, "$"), "*")
+	for i, p := range parts {
+		parts[i] = regexp.QuoteMeta(p)
+	}
+	expr := "^" + strings.Join(parts, ".*")
+	if anchored {
+		expr += "$"
+	}
+	return robotsRule{allow: allow, length: len(path), pattern: regexp.MustCompile(expr)}
+}
+
+// allowed applies the most specific matching rule; Allow wins ties.
+func (r *robotsRules) allowed(path, query string) bool {
+	if path == "" {
+		path = "/"
+	}
+	if query != "" {
+		path += "?" + query
+	}
+
+	best, allow := -1, true
+	for _, rule := range r.rules {
+		if !rule.pattern.MatchString(path) {
+			continue
+		}
+		if rule.length > best || (rule.length == best && rule.allow) {
+			best, allow = rule.length, rule.allow
+		}
+	}
+	return allow
+}
+
+type robotsGroup struct {
+	agents []string
+	rules  []robotsRule
+	delay  time.Duration
+}
+
+// parseRobots returns the rules of every group matching userAgent's product
+// token, or of the "*" groups when none matches, along with the sitemaps.
+func parseRobots(body []byte, userAgent string) *robotsRules {
+	rules := matchingRules(body, userAgent)
+
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if ok && strings.EqualFold(strings.TrimSpace(key), "sitemap") {
+			// Not cut at '#', which may be part of the URL
+			if value = strings.TrimSpace(value); value != "" {
+				rules.sitemaps = append(rules.sitemaps, value)
+			}
+		}
+	}
+	return rules
+}
+
+func matchingRules(body []byte, userAgent string) *robotsRules {
+	var groups []*robotsGroup
+	var current *robotsGroup
+	inRules := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			// Consecutive user-agent lines share a group
+			if current == nil || inRules {
+				current = &robotsGroup{}
+				groups = append(groups, current)
+				inRules = false
+			}
+			current.agents = append(current.agents, strings.ToLower(value))
+		case "allow", "disallow":
+			if current == nil {
+				continue
+			}
+			inRules = true
+			if value != "" {
+				current.rules = append(current.rules, newRobotsRule(key == "allow", value))
+			}
+		case "crawl-delay":
+			if current == nil {
+				continue
+			}
+			inRules = true
+			if secs, err := strconv.ParseFloat(value, 64); err == nil && secs > 0 {
+				current.delay = time.Duration(secs * float64(time.Second))
+			}
+		}
+	}
+
+	token := productToken(userAgent)
+	if rules := mergeGroups(groups, func(agent string) bool { return agent == token }); rules != nil {
+		return rules
+	}
+	if rules := mergeGroups(groups, func(agent string) bool { return agent == "*" }); rules != nil {
+		return rules
+	}
+	return &robotsRules{}
+}
+
+func mergeGroups(groups []*robotsGroup, match func(agent string) bool) *robotsRules {
+	var merged *robotsRules
+	for _, g := range groups {
+		for _, agent := range g.agents {
+			if !match(agent) {
+				continue
+			}
+			if merged == nil {
+				merged = &robotsRules{}
+			}
+			merged.rules = append(merged.rules, g.rules...)
+			if g.delay > merged.delay {
+				merged.delay = g.delay
+			}
+			break
+		}
+	}
+	return merged
+}
+
+// productToken returns the lower-cased name part of a user agent, e.g.
+// "urls-crawler" for "urls-crawler/1.0 (+https://example.com)".
+func productToken(userAgent string) string {
+	fields := strings.Fields(userAgent)
+	if len(fields) == 0 {
+		return ""
+	}
+	token, _, _ := strings.Cut(fields[0], "/")
+	return strings.ToLower(token)
+}
@@ -0,0 +1,77 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRobots(t *testing.T) {
+	body := []byte(`
+# comments are ignored
+User-agent: *
+Disallow: /private/
+Allow: /private/public$
+
+User-agent: urls-crawler
+User-agent: other-bot
+Disallow: /drafts
+Allow: /drafts/published
+Disallow: /*.pdf$
+Crawl-delay: 1.5
+`)
+
+	tests := []struct {
+		name      string
+		userAgent string
+		path      string
+		allowed   bool
+	}{
+		{"star group allows", "someone/2.0", "/docs", true},
+		{"star group disallows", "someone/2.0", "/private/secret", false},
+		{"longest allow wins", "someone/2.0", "/private/public", true},
+		{"anchored pattern", "someone/2.0", "/private/public/more", false},
+		{"named group ignores star rules", "urls-crawler/1.0", "/private/secret", true},
+		{"named group disallows", "urls-crawler/1.0", "/drafts/wip", false},
+		{"named group allows more specific", "URLS-Crawler/1.0", "/drafts/published/x", true},
+		{"wildcard pattern", "urls-crawler/1.0", "/files/report.pdf", false},
+		{"wildcard pattern anchored", "urls-crawler/1.0", "/files/report.pdf?x=1", true},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			rules := parseRobots(body, testCase.userAgent)
+			path, query, _ := strings.Cut(testCase.path, "?")
+			assert.Equal(t, testCase.allowed, rules.allowed(path, query))
+		})
+	}
+
+	assert.Equal(t, 1500*time.Millisecond, parseRobots(body, "urls-crawler").delay)
+	assert.Equal(t, time.Duration(0), parseRobots(body, "someone").delay)
+}
+
+func TestRobotsCheck(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder("GET", "https://example.com/robots.txt",
+		httpmock.NewStringResponder(200, "User-agent: *\nDisallow: /admin\n"))
+	httpmock.RegisterResponder("GET", "https://down.example.com/robots.txt",
+		httpmock.NewStringResponder(503, ""))
+	httpmock.RegisterResponder("GET", "https://missing.example.com/robots.txt",
+		httpmock.NewStringResponder(404, ""))
+
+	c := New(nil, Options{})
+
+	assert.NoError(t, c.robots.Check(context.Background(), "https://example.com/docs"))
+	assert.True(t, errors.Is(c.robots.Check(context.Background(), "https://example.com/admin/users"), ErrDisallowed))
+	assert.True(t, errors.Is(c.robots.Check(context.Background(), "https://down.example.com/"), ErrDisallowed))
+	assert.NoError(t, c.robots.Check(context.Background(), "https://missing.example.com/anything"))
+
+	// robots.txt is fetched once per host
+	assert.Equal(t, 1, httpmock.GetCallCountInfo()["GET https://example.com/robots.txt"])
+}
@@ -1,61 +1,347 @@
 package crawler
 
 import (
+	"bufio"
+	"context"
 	"database/sql"
-	"io"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"time"
 
 	_ "github.com/lib/pq"
+	"url.com/data/internal/extract"
+	"url.com/data/internal/metrics"
+	"url.com/data/internal/urlnorm"
 )
 
 const (
 	dbConnStr = "user=postgres dbname=mydb password=password host=db port=5432 sslmode=disable"
+
+	// DefaultUserAgent is sent when Options.UserAgent is empty.
+	DefaultUserAgent = "urls-crawler/1.0"
 )
 
 var db *sql.DB
 
-func Do(url string, db *sql.DB) error {
-	data, err := FetchURL(url, db)
+// Options configures a Crawler.
+type Options struct {
+	// UserAgent is sent with every request and used to pick the robots.txt group.
+	UserAgent string
+	// IgnoreRobots disables robots.txt and Crawl-delay handling.
+	IgnoreRobots bool
+	// Client configures the HTTP client: timeout, headers, proxy, cookies
+	// and credentials.
+	Client ClientOptions
+	// Retry controls how transient failures are retried.
+	Retry RetryPolicy
+	// FailOnStatus drops non-2xx responses instead of storing them. They are
+	// reported as failures either way.
+	FailOnStatus bool
+	// Conditional revalidates the last stored snapshot of a URL with
+	// If-None-Match/If-Modified-Since instead of downloading it again.
+	Conditional bool
+	// MaxBodySize limits how much of a body is read; 0 means no limit.
+	MaxBodySize int64
+	// TruncateBody stores the first MaxBodySize bytes of larger bodies
+	// instead of rejecting them.
+	TruncateBody bool
+	// ContentTypes lists the media types that are stored, e.g. "text/html"
+	// or "text/*". An empty list stores everything.
+	ContentTypes []string
+	// Rules extract fields from the pages they match, stored along with
+	// the response.
+	Rules *extract.Rules
+	// Normalizer canonicalizes the links found in crawl mode, so that each
+	// page is crawled once whichever way it is linked to.
+	Normalizer *urlnorm.Normalizer
+	// Metrics records fetches, retries and store latencies when set.
+	Metrics *metrics.Metrics
+}
+
+// Crawler fetches URLs and stores their responses in a ResultStore.
+type Crawler struct {
+	store  ResultStore
+	opts   Options
+	client *http.Client
+	robots *Robots
+	// jobID is the crawl job the crawler fetches for, 0 outside jobs.
+	jobID int64
+}
+
+// New returns a Crawler that stores responses in store.
+func New(store ResultStore, opts Options) *Crawler {
+	if opts.UserAgent == "" {
+		opts.UserAgent = DefaultUserAgent
+	}
+
+	c := &Crawler{
+		store:  store,
+		opts:   opts,
+		client: newClient(opts.Client),
+	}
+	if !opts.IgnoreRobots {
+		c.robots = NewRobots(c.client, opts.UserAgent)
+	}
+	return c
+}
+
+func (c *Crawler) Do(ctx context.Context, url string) error {
+	resp, err := c.FetchURL(ctx, url)
 	if err != nil {
 		return err
 	}
-	err = SaveURL(url, data, db)
+	defer resp.Close()
+	c.extract(resp)
+
+	err = c.SaveURL(ctx, resp)
 	if err != nil {
 		return err
 	}
+	if resp.StatusErr != nil {
+		return resp.StatusErr
+	}
 	return nil
 }
 
-// FetchURL fetches a URL, processes the response, and stores it in the database
-func FetchURL(url string, db *sql.DB) ([]byte, error) {
+// Visit fetches and stores url like Do, and describes the outcome as a
+// Result.
+func (c *Crawler) Visit(ctx context.Context, url string) Result {
+	resp, result := c.visit(ctx, url)
+	resp.Close()
+	return result
+}
+
+// visit fetches and stores url. The response is returned for the caller to
+// inspect and Close, or nil if it could not be fetched.
+func (c *Crawler) visit(ctx context.Context, url string) (*Response, Result) {
+	start := time.Now()
+	result := Result{URL: url}
 
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Get(url)
+	resp, err := c.FetchURL(ctx, url)
 	if err != nil {
-		log.Printf("failed to fetch URL %s: %v", url, err)
-		return nil, err
+		var fetchErr *FetchError
+		if errors.As(err, &fetchErr) {
+			result.StatusCode, result.Attempts = fetchErr.StatusCode, fetchErr.Attempts
+		}
+		result.Err, result.Duration = err, time.Since(start)
+		return nil, result
 	}
-	defer resp.Body.Close()
+	result.StatusCode, result.Bytes, result.Attempts = resp.StatusCode, resp.ContentLength, resp.Attempts
+	result.FinalURL, result.CertNotAfter = resp.FinalURL, resp.TLS.NotAfter()
+	c.extract(resp)
 
-	// Read the response body
-	body, err := io.ReadAll(resp.Body)
+	if err := c.SaveURL(ctx, resp); err != nil {
+		resp.Close()
+		result.Err, result.Duration = err, time.Since(start)
+		return nil, result
+	}
+	result.Duration = time.Since(start)
+	if resp.StatusErr != nil {
+		// Stored, but there is nothing to crawl in an error page
+		resp.Close()
+		result.Err = resp.StatusErr
+		return nil, result
+	}
+	return resp, result
+}
+
+// forJob returns a copy of c that records job as the job of the responses
+// it stores. It keeps cookies in a jar of its own.
+func (c *Crawler) forJob(job int64) *Crawler {
+	jc := *c
+	jc.jobID = job
+	if c.client.Jar != nil {
+		client := *c.client
+		client.Jar = newJar(c.opts.Client)
+		jc.client = &client
+	}
+	return &jc
+}
+
+// extract applies the extraction rules to resp, fetched for the crawler's
+// job. Revalidated responses keep the values stored with the response they
+// point at, and a page the rules cannot be applied to is still stored.
+func (c *Crawler) extract(resp *Response) {
+	resp.JobID = c.jobID
+	if c.opts.Rules == nil || resp.Unchanged != nil || resp.Body == nil || !c.opts.Rules.Matches(resp.URL) {
+		return
+	}
+	values, err := c.opts.Rules.Apply(resp.URL, resp.HTML(), resp.IsHTML())
 	if err != nil {
-		log.Printf("failed to read response body from %s: %v", url, err)
-		return nil, err
+		log.Printf("failed to extract fields of URL %s: %v", resp.URL, err)
+		return
+	}
+	resp.Extracted = values
+}
+
+// FetchURL fetches a URL, retrying transient failures according to the
+// retry policy. Errors are returned as *FetchError.
+func (c *Crawler) FetchURL(ctx context.Context, url string) (*Response, error) {
+	if c.robots != nil {
+		if err := c.robots.Check(ctx, url); err != nil {
+			if !errors.Is(err, ErrDisallowed) {
+				return nil, transportError(url, err)
+			}
+			log.Printf("skipping URL %s: %v", url, err)
+			return nil, &FetchError{URL: url, Kind: Policy, Err: err}
+		}
+	}
+
+	var previous *Snapshot
+	if c.opts.Conditional {
+		snapshot, err := c.store.LastSnapshot(ctx, url)
+		if err != nil {
+			// Not fatal, we just download the page in full
+			log.Printf("failed to look up previous snapshot of %s: %v", url, err)
+		} else if snapshot.hasValidators() {
+			previous = snapshot
+		}
+	}
+
+	for attempt := 1; ; attempt++ {
+		start := time.Now()
+		resp, wait, fetchErr := c.fetchOnce(ctx, url, previous)
+		if fetchErr == nil {
+			c.opts.Metrics.Fetched(url, resp.StatusCode, resp.ContentLength, time.Since(start))
+			resp.Attempts = attempt
+			if resp.StatusErr != nil {
+				resp.StatusErr.Attempts = attempt
+			}
+			return resp, nil
+		}
+		c.opts.Metrics.Fetched(url, fetchErr.StatusCode, 0, time.Since(start))
+		fetchErr.Attempts = attempt
+
+		if fetchErr.Kind != Transient || attempt > c.opts.Retry.MaxRetries {
+			log.Printf("failed to fetch URL %s: %v", url, fetchErr)
+			return nil, fetchErr
+		}
+
+		delay := c.opts.Retry.backoff(attempt)
+		if wait > delay {
+			if c.opts.Retry.MaxDelay > 0 && wait > c.opts.Retry.MaxDelay {
+				log.Printf("giving up on URL %s, server asked to retry after %v: %v", url, wait, fetchErr)
+				return nil, fetchErr
+			}
+			delay = wait
+		}
+		log.Printf("retrying URL %s in %v: %v", url, delay, fetchErr)
+		c.opts.Metrics.Retried(url)
+		if err := sleep(ctx, delay); err != nil {
+			return nil, fetchErr
+		}
 	}
-	return body, nil
 }
 
-// Insert the URL and response into the database
-func SaveURL(url string, data []byte, db *sql.DB) error {
-	const insertURLResponseQuery = `INSERT INTO url_responses (url, response) VALUES ($1, $2)`
-	_, err := db.Exec(insertURLResponseQuery, url, string(data))
+// fetchOnce makes a single attempt at fetching url, revalidating previous if
+// set. For retryable statuses it also returns how long the server asked us to
+// wait through Retry-After.
+func (c *Crawler) fetchOnce(ctx context.Context, url string, previous *Snapshot) (*Response, time.Duration, *FetchError) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, 0, &FetchError{URL: url, Kind: Permanent, Err: err}
+	}
+	req.Header.Set("User-Agent", c.opts.UserAgent)
+	req.Header.Set("Accept-Encoding", acceptEncoding)
+	if previous != nil {
+		previous.setConditionalHeaders(req)
+	}
 
+	start := time.Now()
+	resp, err := c.client.Do(req)
 	if err != nil {
-		log.Printf("failed to insert URL %s into database: %v", url, err)
-		return err
+		return nil, 0, transportError(url, err)
 	}
-	return nil
+	defer resp.Body.Close()
+
+	notModified := previous != nil && resp.StatusCode == http.StatusNotModified
+	var statusErr *FetchError
+	if !notModified && (resp.StatusCode < 200 || resp.StatusCode > 299) {
+		statusErr = statusError(url, resp.StatusCode)
+		if statusErr.Kind == Transient {
+			return nil, retryAfter(resp.Header.Get("Retry-After")), statusErr
+		}
+		if c.opts.FailOnStatus {
+			return nil, 0, statusErr
+		}
+	}
+
+	decoded, err := decodeContentEncoding(resp.Header.Get("Content-Encoding"), resp.Body)
+	if err != nil {
+		return nil, 0, &FetchError{URL: url, Kind: Permanent, StatusCode: resp.StatusCode, Err: err}
+	}
+	contentType := resp.Header.Get("Content-Type")
+	body := bufio.NewReader(decoded)
+	if !notModified && len(c.opts.ContentTypes) > 0 {
+		sniffed := contentType
+		if sniffed == "" {
+			peek, _ := body.Peek(512)
+			sniffed = http.DetectContentType(peek)
+		}
+		mediaType := (&Response{ContentType: sniffed}).MediaType()
+		if !contentTypeAllowed(mediaType, c.opts.ContentTypes) {
+			return nil, 0, &FetchError{URL: url, Kind: Policy, StatusCode: resp.StatusCode, Err: fmt.Errorf("%w: %s", ErrContentType, mediaType)}
+		}
+	}
+	// Content-Length counts encoded bytes, while the limit applies to the
+	// decoded body: only reject early when nothing is decoded
+	if !c.opts.TruncateBody && c.opts.MaxBodySize > 0 && decoded == resp.Body && resp.ContentLength > c.opts.MaxBodySize {
+		return nil, 0, &FetchError{URL: url, Kind: Policy, StatusCode: resp.StatusCode, Err: ErrBodyTooLarge}
+	}
+
+	finalURL := url
+	if resp.Request != nil {
+		finalURL = resp.Request.URL.String()
+	}
+
+	result := &Response{
+		URL:          url,
+		FinalURL:     finalURL,
+		StatusCode:   resp.StatusCode,
+		Header:       resp.Header,
+		ContentType:  contentType,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		FetchedAt:    start.UTC(),
+		TLS:          newTLSInfo(resp.TLS),
+		StatusErr:    statusErr,
+	}
+
+	// Read the response body
+	if err := result.readBody(body, c.opts.MaxBodySize, c.opts.TruncateBody); err != nil {
+		result.Close()
+		if errors.Is(err, ErrBodyTooLarge) {
+			return nil, 0, &FetchError{URL: url, Kind: Policy, StatusCode: resp.StatusCode, Err: err}
+		}
+		return nil, 0, transportError(url, err)
+	}
+	result.Duration = time.Since(start)
+	result.decodeText()
+	if !notModified {
+		result.extractMetadata()
+	}
+
+	if notModified {
+		// Validators may be omitted from a 304, keep the ones we revalidated
+		result.Unchanged = previous
+		if result.ETag == "" {
+			result.ETag = previous.ETag
+		}
+		if result.LastModified == "" {
+			result.LastModified = previous.LastModified
+		}
+	}
+	return result, 0, nil
+}
+
+// SaveURL stores the response and its metadata in the crawler's ResultStore.
+func (c *Crawler) SaveURL(ctx context.Context, resp *Response) error {
+	start := time.Now()
+	err := c.store.SaveResponse(ctx, resp)
+	if err == nil {
+		c.opts.Metrics.Stored(time.Since(start))
+	}
+	return err
 }
@@ -1,12 +1,18 @@
 package crawler
 
 import (
+	"context"
+	"database/sql/driver"
 	"fmt"
+	"net/http"
+	"path/filepath"
 	"testing"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/jarcoal/httpmock"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"url.com/data/internal/extract"
 )
 
 func TestFetchURL(t *testing.T) {
@@ -37,6 +43,8 @@ func TestFetchURL(t *testing.T) {
 	// Activate HTTP mock
 	httpmock.Activate()
 	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder("GET", "https://jsonplaceholder.typicode.com/robots.txt",
+		httpmock.NewStringResponder(404, ""))
 
 	for _, testCase := range tests {
 		t.Run(testCase.name, func(t *testing.T) {
@@ -52,19 +60,25 @@ func TestFetchURL(t *testing.T) {
 			defer db.Close()
 
 			// Setup mock database interaction for SaveURL
+			mock.ExpectExec(`INSERT INTO url_contents`).
+				WithArgs(ContentHash([]byte(testCase.mockHttpResponse)), "identity", int64(len(testCase.mockHttpResponse)),
+					[]byte(testCase.mockHttpResponse), "utf-8", testCase.mockHttpResponse).
+				WillReturnResult(sqlmock.NewResult(1, 1))
 			if testCase.mockSaveURLError {
 				// Simulate a database error (failed insert)
 				mock.ExpectExec(`INSERT INTO url_responses`).
-					WithArgs(testCase.url, testCase.mockHttpResponse).
+					WithArgs(responseArgs(testCase.url, ContentHash([]byte(testCase.mockHttpResponse)), 200,
+						int64(len(testCase.mockHttpResponse)), nil)...).
 					WillReturnError(fmt.Errorf("failed to insert into database"))
 			} else {
 				// Simulate successful insert into the database
 				mock.ExpectExec(`INSERT INTO url_responses`).
-					WithArgs(testCase.url, testCase.mockHttpResponse).
+					WithArgs(responseArgs(testCase.url, ContentHash([]byte(testCase.mockHttpResponse)), 200,
+						int64(len(testCase.mockHttpResponse)), nil)...).
 					WillReturnResult(sqlmock.NewResult(1, 1))
 			}
 
-			result := Do(testCase.url, db)
+			result := New(NewPostgresStore(db, NoCompression), Options{}).Do(context.Background(), testCase.url)
 
 			// Assert the result is as expected
 			assert.Equal(t, testCase.expectedResult, result)
@@ -76,3 +90,125 @@ func TestFetchURL(t *testing.T) {
 		})
 	}
 }
+
+// responseArgs returns the arguments SaveURL is expected to insert into
+// url_responses, ignoring headers and timings.
+func responseArgs(url string, contentHash interface{}, status int, length int64, unchangedFrom interface{}) []driver.Value {
+	return []driver.Value{
+		url, contentHash, status, url, sqlmock.AnyArg(), sqlmock.AnyArg(), length, sqlmock.AnyArg(), sqlmock.AnyArg(),
+		sqlmock.AnyArg(), sqlmock.AnyArg(), unchangedFrom, false,
+		// Page metadata
+		sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(),
+		sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(),
+		// TLS
+		nil, nil,
+		// Job
+		nil,
+	}
+}
+
+func TestFetchURLFailOnStatus(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder("GET", "https://example.com/missing",
+		httpmock.NewStringResponder(404, "not found"))
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	// Stored by default, but still reported as a permanent failure
+	mock.ExpectExec(`INSERT INTO url_contents`).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`INSERT INTO url_responses`).
+		WithArgs(responseArgs("https://example.com/missing", ContentHash([]byte("not found")), 404, 9, nil)...).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	err = New(NewPostgresStore(db, NoCompression), Options{IgnoreRobots: true}).Do(context.Background(), "https://example.com/missing")
+	assert.Equal(t, Permanent, KindOf(err))
+	assert.Equal(t, 1, httpmock.GetCallCountInfo()["GET https://example.com/missing"])
+
+	// Reported as a permanent failure and not stored with FailOnStatus
+	err = New(NewPostgresStore(db, NoCompression), Options{IgnoreRobots: true, FailOnStatus: true}).Do(context.Background(), "https://example.com/missing")
+	assert.Equal(t, Permanent, KindOf(err))
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unmet expectations: %v", err)
+	}
+}
+
+func TestDoConditional(t *testing.T) {
+	const url = "https://example.com/page"
+
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder("GET", url, func(req *http.Request) (*http.Response, error) {
+		if req.Header.Get("If-None-Match") == `"v1"` {
+			// Sent with the encoding of the full response, but no body
+			resp := httpmock.NewStringResponse(304, "")
+			resp.Header.Set("Content-Encoding", "gzip")
+			return resp, nil
+		}
+		resp := httpmock.NewStringResponse(200, "page")
+		resp.Header.Set("ETag", `"v1"`)
+		return resp, nil
+	})
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	c := New(NewPostgresStore(db, NoCompression), Options{IgnoreRobots: true, Conditional: true})
+
+	// First run: nothing stored yet, full download
+	mock.ExpectQuery(`SELECT id, .* FROM url_responses`).WithArgs(url).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "etag", "last_modified"}))
+	mock.ExpectExec(`INSERT INTO url_contents`).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`INSERT INTO url_responses`).
+		WithArgs(responseArgs(url, ContentHash([]byte("page")), 200, 4, nil)...).
+		WillReturnResult(sqlmock.NewResult(7, 1))
+	assert.NoError(t, c.Do(context.Background(), url))
+
+	// Second run: revalidated, stored without a body and pointing at row 7
+	mock.ExpectQuery(`SELECT id, .* FROM url_responses`).WithArgs(url).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "etag", "last_modified"}).AddRow(7, `"v1"`, ""))
+	mock.ExpectExec(`INSERT INTO url_responses`).
+		WithArgs(responseArgs(url, nil, 304, 0, int64(7))...).
+		WillReturnResult(sqlmock.NewResult(8, 1))
+	assert.NoError(t, c.Do(context.Background(), url))
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unmet expectations: %v", err)
+	}
+}
+
+func TestDoExtract(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder("GET", "https://example.com/releases/1",
+		httpmock.NewStringResponder(200, `<html><h1>Release</h1><span class="v">1.2.0</span></html>`).HeaderSet(http.Header{"Content-Type": {"text/html"}}))
+	httpmock.RegisterResponder("GET", "https://example.com/about",
+		httpmock.NewStringResponder(200, `<html><span class="v">none</span></html>`))
+
+	rules, err := extract.Compile([]extract.Rule{
+		{URL: "/releases/", Fields: []extract.Field{{Name: "version", CSS: ".v"}}},
+	})
+	require.NoError(t, err)
+	store, err := OpenSQLiteStore(filepath.Join(t.TempDir(), "urls.db"), NoCompression)
+	require.NoError(t, err)
+	defer store.Close()
+
+	c := New(store, Options{IgnoreRobots: true, Rules: rules}).forJob(4)
+	assert.NoError(t, c.Do(context.Background(), "https://example.com/releases/1"))
+	assert.NoError(t, c.Do(context.Background(), "https://example.com/about"))
+
+	var url, value string
+	var jobID int64
+	err = store.DB().QueryRow(`SELECT job_id, url, value FROM extracted_fields WHERE field = 'version'`).Scan(&jobID, &url, &value)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), jobID)
+	assert.Equal(t, "https://example.com/releases/1", url)
+	assert.Equal(t, "1.2.0", value)
+}
@@ -0,0 +1,235 @@
+package crawler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// maxSitemapSize is the largest uncompressed sitemap allowed by the
+	// sitemaps.org protocol.
+	maxSitemapSize = 50 << 20
+	// maxSitemapDepth limits how deep sitemap indexes may nest. The protocol
+	// allows none, but sites do link indexes from indexes.
+	maxSitemapDepth = 3
+)
+
+// SitemapEntry is a page listed in a sitemap. LastMod is zero when the
+// sitemap does not say when the page last changed.
+type SitemapEntry struct {
+	URL     string
+	LastMod time.Time
+}
+
+// sitemapDoc covers both <urlset> and <sitemapindex> documents.
+type sitemapDoc struct {
+	XMLName  xml.Name
+	URLs     []sitemapLoc `xml:"url"`
+	Sitemaps []sitemapLoc `xml:"sitemap"`
+}
+
+type sitemapLoc struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod"`
+}
+
+// Sitemap returns the pages listed in the sitemaps of target, which is either
+// a sitemap URL or a site such as "example.com" or "https://example.com/".
+// The sitemaps of a site are those its robots.txt lists, or /sitemap.xml.
+// Sitemap indexes are followed and gzipped sitemaps decompressed; each page
+// is returned once.
+func (c *Crawler) Sitemap(ctx context.Context, target string) ([]SitemapEntry, error) {
+	if !strings.Contains(target, "://") {
+		target = "https://" + target
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+
+	sitemaps := []string{target}
+	if u.Path == "" || u.Path == "/" {
+		robots := c.robots
+		if robots == nil {
+			// Read for its Sitemap lines only
+			robots = NewRobots(c.client, c.opts.UserAgent)
+		}
+		if sitemaps, err = robots.Sitemaps(ctx, target); err != nil {
+			return nil, err
+		}
+		if len(sitemaps) == 0 {
+			sitemaps = []string{u.Scheme + "://" + u.Host + "/sitemap.xml"}
+		}
+	}
+
+	// Only fail when none of the site's sitemaps could be read
+	s := &sitemapReader{c: c, visited: make(map[string]bool), seen: make(map[string]bool)}
+	var lastErr error
+	read := 0
+	for _, sitemap := range sitemaps {
+		if err := s.read(ctx, sitemap, 0); err != nil {
+			if ctx.Err() != nil {
+				return nil, err
+			}
+			log.Printf("skipping sitemap: %v", err)
+			lastErr = err
+			continue
+		}
+		read++
+	}
+	if read == 0 {
+		return nil, lastErr
+	}
+	return s.entries, nil
+}
+
+// sitemapReader collects the pages of nested sitemaps.
+type sitemapReader struct {
+	c       *Crawler
+	visited map[string]bool
+	seen    map[string]bool
+	entries []SitemapEntry
+}
+
+// read adds the pages of the sitemap at sitemapURL, following indexes up to
+// maxSitemapDepth. Broken sitemaps inside an index are logged and skipped.
+func (s *sitemapReader) read(ctx context.Context, sitemapURL string, depth int) error {
+	if s.visited[sitemapURL] {
+		return nil
+	}
+	s.visited[sitemapURL] = true
+
+	body, err := s.c.fetchSitemap(ctx, sitemapURL)
+	if err != nil {
+		return fmt.Errorf("failed to fetch sitemap %s: %w", sitemapURL, err)
+	}
+	var doc sitemapDoc
+	if err := xml.Unmarshal(body, &doc); err != nil {
+		return fmt.Errorf("failed to parse sitemap %s: %w", sitemapURL, err)
+	}
+
+	switch doc.XMLName.Local {
+	case "urlset":
+		for _, loc := range doc.URLs {
+			page := strings.TrimSpace(loc.Loc)
+			if u, err := url.Parse(page); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				log.Printf("skipping invalid URL %q in sitemap %s", page, sitemapURL)
+				continue
+			}
+			if s.seen[page] {
+				continue
+			}
+			s.seen[page] = true
+			s.entries = append(s.entries, SitemapEntry{URL: page, LastMod: parseLastMod(loc.LastMod)})
+		}
+	case "sitemapindex":
+		if depth >= maxSitemapDepth {
+			log.Printf("skipping sitemap index %s nested %d levels deep", sitemapURL, depth)
+			return nil
+		}
+		for _, loc := range doc.Sitemaps {
+			child := strings.TrimSpace(loc.Loc)
+			if child == "" {
+				continue
+			}
+			if err := s.read(ctx, child, depth+1); err != nil {
+				if ctx.Err() != nil {
+					return err
+				}
+				log.Printf("skipping sitemap: %v", err)
+			}
+		}
+	default:
+		return fmt.Errorf("%s is not a sitemap: unexpected <%s> element", sitemapURL, doc.XMLName.Local)
+	}
+	return nil
+}
+
+// fetchSitemap downloads a sitemap, decompressing it if it is gzipped.
+func (c *Crawler) fetchSitemap(ctx context.Context, sitemapURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, sitemapURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", c.opts.UserAgent)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxSitemapSize+1))
+	if err != nil {
+		return nil, err
+	}
+	// sitemap.xml.gz is served as a gzip file, not with Content-Encoding
+	if bytes.HasPrefix(body, []byte{0x1f, 0x8b}) {
+		zr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		if body, err = io.ReadAll(io.LimitReader(zr, maxSitemapSize+1)); err != nil {
+			return nil, err
+		}
+	}
+	if len(body) > maxSitemapSize {
+		return nil, fmt.Errorf("sitemap over %d bytes", maxSitemapSize)
+	}
+	return body, nil
+}
+
+// lastModLayouts are the W3C datetime formats allowed for <lastmod>.
+var lastModLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02",
+	"2006-01",
+	"2006",
+}
+
+// parseLastMod parses a <lastmod> value, returning the zero time for missing
+// or malformed ones.
+func parseLastMod(value string) time.Time {
+	value = strings.TrimSpace(value)
+	for _, layout := range lastModLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// SkipUnchanged returns the URLs of entries, leaving out the pages whose
+// lastmod is not after the last time they were stored, and how many were
+// left out.
+func (c *Crawler) SkipUnchanged(ctx context.Context, entries []SitemapEntry) ([]string, int) {
+	var urls []string
+	skipped := 0
+	for _, e := range entries {
+		if !e.LastMod.IsZero() {
+			snapshots, err := c.store.Snapshots(ctx, e.URL, 1)
+			if err != nil {
+				// Not fatal, the page is fetched again
+				log.Printf("failed to look up previous snapshot of %s: %v", e.URL, err)
+			} else if len(snapshots) > 0 && !e.LastMod.After(snapshots[0].FetchedAt) {
+				skipped++
+				continue
+			}
+		}
+		urls = append(urls, e.URL)
+	}
+	return urls, skipped
+}
@@ -0,0 +1,103 @@
+package crawler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func gzipped(t *testing.T, s string) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write([]byte(s))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func TestSitemap(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder("GET", "https://example.com/robots.txt",
+		httpmock.NewStringResponder(200, "User-agent: *\nDisallow: /admin\n\nSitemap: https://example.com/sitemap_index.xml\n"))
+	httpmock.RegisterResponder("GET", "https://example.com/sitemap_index.xml",
+		httpmock.NewStringResponder(200, `<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <sitemap><loc>https://example.com/pages.xml</loc></sitemap>
+  <sitemap><loc>https://example.com/posts.xml.gz</loc></sitemap>
+  <sitemap><loc>https://example.com/sitemap_index.xml</loc></sitemap>
+  <sitemap><loc>https://example.com/gone.xml</loc></sitemap>
+</sitemapindex>`))
+	httpmock.RegisterResponder("GET", "https://example.com/pages.xml",
+		httpmock.NewStringResponder(200, `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>https://example.com/</loc><lastmod>2024-05-01</lastmod></url>
+  <url><loc> https://example.com/about </loc></url>
+  <url><loc>/relative</loc></url>
+</urlset>`))
+	httpmock.RegisterResponder("GET", "https://example.com/posts.xml.gz",
+		httpmock.NewBytesResponder(200, gzipped(t, `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>https://example.com/posts/1</loc><lastmod>2024-05-02T10:30:00+02:00</lastmod></url>
+  <url><loc>https://example.com/</loc></url>
+</urlset>`)))
+	httpmock.RegisterResponder("GET", "https://example.com/gone.xml", httpmock.NewStringResponder(404, ""))
+
+	c := New(NewPostgresStore(nil, NoCompression), Options{})
+	entries, err := c.Sitemap(context.Background(), "example.com")
+
+	require.NoError(t, err)
+	assert.Equal(t, []SitemapEntry{
+		{URL: "https://example.com/", LastMod: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)},
+		{URL: "https://example.com/about"},
+		{URL: "https://example.com/posts/1", LastMod: time.Date(2024, 5, 2, 8, 30, 0, 0, time.UTC)},
+	}, normalizeLastMods(entries))
+
+	// Without Sitemap lines, /sitemap.xml is read
+	httpmock.RegisterResponder("GET", "https://other.example.com/robots.txt", httpmock.NewStringResponder(404, ""))
+	httpmock.RegisterResponder("GET", "https://other.example.com/sitemap.xml",
+		httpmock.NewStringResponder(200, `<urlset><url><loc>https://other.example.com/a</loc></url></urlset>`))
+	entries, err = c.Sitemap(context.Background(), "https://other.example.com/")
+	require.NoError(t, err)
+	assert.Equal(t, []SitemapEntry{{URL: "https://other.example.com/a"}}, entries)
+
+	_, err = c.Sitemap(context.Background(), "https://example.com/gone.xml")
+	assert.Error(t, err)
+}
+
+// normalizeLastMods converts lastmods to UTC for comparison.
+func normalizeLastMods(entries []SitemapEntry) []SitemapEntry {
+	for i := range entries {
+		if !entries[i].LastMod.IsZero() {
+			entries[i].LastMod = entries[i].LastMod.UTC()
+		}
+	}
+	return entries
+}
+
+func TestSkipUnchanged(t *testing.T) {
+	ctx := context.Background()
+	store, err := OpenFileStore(t.TempDir(), NoCompression)
+	require.NoError(t, err)
+	defer store.Close()
+
+	fetched := time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC)
+	for _, url := range []string{"https://example.com/old", "https://example.com/new"} {
+		require.NoError(t, store.SaveResponse(ctx, &Response{
+			URL: url, FinalURL: url, StatusCode: 200, FetchedAt: fetched, Body: []byte(url),
+		}))
+	}
+
+	urls, skipped := New(store, Options{}).SkipUnchanged(ctx, []SitemapEntry{
+		{URL: "https://example.com/old", LastMod: fetched.Add(-time.Hour)},
+		{URL: "https://example.com/new", LastMod: fetched.Add(time.Hour)},
+		{URL: "https://example.com/undated"},
+		{URL: "https://example.com/unseen", LastMod: fetched},
+	})
+	assert.Equal(t, []string{"https://example.com/new", "https://example.com/undated", "https://example.com/unseen"}, urls)
+	assert.Equal(t, 1, skipped)
+}
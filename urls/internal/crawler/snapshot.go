@@ -0,0 +1,156 @@
+package crawler
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// Snapshot is a previously stored response of a URL along with the validators
+// needed to revalidate it with a conditional request.
+type Snapshot struct {
+	ID           int64
+	ETag         string
+	LastModified string
+	// FetchedAt and ContentHash are only set by Snapshots.
+	FetchedAt   time.Time
+	ContentHash string
+}
+
+// hasValidators reports whether the snapshot can be revalidated.
+func (s *Snapshot) hasValidators() bool {
+	return s != nil && (s.ETag != "" || s.LastModified != "")
+}
+
+// setConditionalHeaders adds If-None-Match and If-Modified-Since to req.
+func (s *Snapshot) setConditionalHeaders(req *http.Request) {
+	if s.ETag != "" {
+		req.Header.Set("If-None-Match", s.ETag)
+	}
+	if s.LastModified != "" {
+		req.Header.Set("If-Modified-Since", s.LastModified)
+	}
+}
+
+// LastSnapshot returns the most recent stored response of url that has a body,
+// or nil if there is none.
+func (s *SQLStore) LastSnapshot(ctx context.Context, url string) (*Snapshot, error) {
+	const selectLastSnapshotQuery = `
+		SELECT id, COALESCE(etag, ''), COALESCE(last_modified, '')
+		FROM url_responses
+		WHERE url = $1 AND unchanged_from IS NULL AND status_code BETWEEN 200 AND 299
+		ORDER BY id DESC
+		LIMIT 1`
+
+	var snapshot Snapshot
+	err := s.db.QueryRowContext(ctx, selectLastSnapshotQuery, url).Scan(&snapshot.ID, &snapshot.ETag, &snapshot.LastModified)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+// Snapshots returns up to limit stored 2xx responses of url that have a body,
+// most recent first.
+func (s *SQLStore) Snapshots(ctx context.Context, url string, limit int) ([]Snapshot, error) {
+	const selectSnapshotsQuery = `
+		SELECT id, COALESCE(etag, ''), COALESCE(last_modified, ''), fetched_at, COALESCE(content_hash, '')
+		FROM url_responses
+		WHERE url = $1 AND unchanged_from IS NULL AND status_code BETWEEN 200 AND 299
+		ORDER BY id DESC
+		LIMIT $2`
+
+	rows, err := s.db.QueryContext(ctx, selectSnapshotsQuery, url, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var snapshots []Snapshot
+	for rows.Next() {
+		var snapshot Snapshot
+		if err := rows.Scan(&snapshot.ID, &snapshot.ETag, &snapshot.LastModified, &snapshot.FetchedAt, &snapshot.ContentHash); err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	return snapshots, rows.Err()
+}
+
+// LoadSnapshot returns the stored response with the given id, following
+// unchanged responses to the body they revalidated. Hash is empty when no
+// body was stored.
+func (s *SQLStore) LoadSnapshot(ctx context.Context, id int64) (*Response, error) {
+	const selectSnapshotQuery = `
+		SELECT r.url, COALESCE(r.final_url, r.url), COALESCE(r.status_code, 0), COALESCE(r.content_type, ''),
+		       r.unchanged_from, COALESCE(c.hash, ''), COALESCE(c.encoding, ''), c.data, COALESCE(c.charset, ''), COALESCE(c.text, '')
+		FROM url_responses r
+		LEFT JOIN url_contents c ON c.hash = r.content_hash
+		WHERE r.id = $1`
+
+	var resp Response
+	var unchangedFrom sql.NullInt64
+	var encoding string
+	var data []byte
+	err := s.db.QueryRowContext(ctx, selectSnapshotQuery, id).
+		Scan(&resp.URL, &resp.FinalURL, &resp.StatusCode, &resp.ContentType, &unchangedFrom, &resp.Hash, &encoding, &data,
+			&resp.Charset, &resp.Text)
+	if err != nil {
+		return nil, err
+	}
+
+	if unchangedFrom.Valid {
+		previous, err := s.LoadSnapshot(ctx, unchangedFrom.Int64)
+		if err != nil {
+			return nil, err
+		}
+		resp.Body, resp.Hash = previous.Body, previous.Hash
+		resp.Charset, resp.Text = previous.Charset, previous.Text
+		if resp.ContentType == "" {
+			resp.ContentType = previous.ContentType
+		}
+	} else {
+		if data == nil && encoding != "" {
+			// Large bodies are stored in chunks
+			if data, err = s.loadChunks(ctx, id); err != nil {
+				return nil, err
+			}
+		}
+		if resp.Body, err = decompress(Compression(encoding), data); err != nil {
+			return nil, err
+		}
+	}
+
+	resp.ContentLength = int64(len(resp.Body))
+	return &resp, nil
+}
+
+func (s *SQLStore) loadChunks(ctx context.Context, id int64) ([]byte, error) {
+	const selectChunksQuery = `
+		SELECT k.data
+		FROM url_responses r
+		JOIN url_content_chunks k ON k.hash = r.content_hash
+		WHERE r.id = $1
+		ORDER BY k.seq`
+
+	rows, err := s.db.QueryContext(ctx, selectChunksQuery, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var data []byte
+	for rows.Next() {
+		var chunk []byte
+		if err := rows.Scan(&chunk); err != nil {
+			return nil, err
+		}
+		data = append(data, chunk...)
+	}
+	return data, rows.Err()
+}
@@ -0,0 +1,141 @@
+package crawler
+
+import (
+	"database/sql"
+	"fmt"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqliteSchema mirrors the Postgres migrations for the tables the crawler
+// writes to. Keep it in sync when adding migrations.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS url_contents (
+  hash       TEXT PRIMARY KEY,
+  encoding   TEXT NOT NULL DEFAULT 'identity',
+  size       INTEGER NOT NULL,
+  data       BLOB,
+  charset    TEXT,
+  text       TEXT,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS url_content_chunks (
+  hash TEXT    NOT NULL REFERENCES url_contents (hash) ON DELETE CASCADE,
+  seq  INTEGER NOT NULL,
+  data BLOB    NOT NULL,
+  PRIMARY KEY (hash, seq)
+);
+
+CREATE TABLE IF NOT EXISTS url_responses (
+  id                INTEGER PRIMARY KEY AUTOINCREMENT,
+  url               TEXT NOT NULL,
+  content_hash      TEXT REFERENCES url_contents (hash),
+  status_code       INTEGER,
+  final_url         TEXT,
+  headers           TEXT,
+  content_type      TEXT,
+  content_length    INTEGER,
+  fetch_duration_ms INTEGER,
+  fetched_at        TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  etag              TEXT,
+  last_modified     TEXT,
+  unchanged_from    INTEGER REFERENCES url_responses (id),
+  truncated         BOOLEAN NOT NULL DEFAULT false,
+  title             TEXT,
+  description       TEXT,
+  canonical_url     TEXT,
+  robots            TEXT,
+  lang              TEXT,
+  open_graph        TEXT,
+  twitter           TEXT,
+  headings          TEXT,
+  json_ld           TEXT,
+  tls               TEXT,
+  cert_not_after    TIMESTAMP,
+  job_id            INTEGER
+);
+
+CREATE TABLE IF NOT EXISTS extracted_fields (
+  id         INTEGER PRIMARY KEY AUTOINCREMENT,
+  job_id     INTEGER,
+  url        TEXT NOT NULL,
+  final_url  TEXT,
+  field      TEXT NOT NULL,
+  seq        INTEGER NOT NULL DEFAULT 0,
+  value      TEXT NOT NULL,
+  fetched_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+`
+
+// sqliteIndexes are created once sqliteColumns were added, since they may
+// cover them.
+const sqliteIndexes = `
+CREATE INDEX IF NOT EXISTS url_responses_url_id_idx ON url_responses (url, id DESC);
+CREATE INDEX IF NOT EXISTS url_responses_content_hash_idx ON url_responses (content_hash);
+CREATE INDEX IF NOT EXISTS url_responses_job_id_idx ON url_responses (job_id, id);
+CREATE INDEX IF NOT EXISTS url_responses_cert_not_after_idx ON url_responses (cert_not_after);
+CREATE INDEX IF NOT EXISTS extracted_fields_job_field_idx ON extracted_fields (job_id, field);
+CREATE INDEX IF NOT EXISTS extracted_fields_field_url_idx ON extracted_fields (field, url, fetched_at DESC);
+`
+
+// sqliteColumns are the columns added to tables after they were first
+// created, added to databases written by older versions on open.
+var sqliteColumns = []struct{ table, column, definition string }{
+	{"url_responses", "title", "TEXT"},
+	{"url_responses", "description", "TEXT"},
+	{"url_responses", "canonical_url", "TEXT"},
+	{"url_responses", "robots", "TEXT"},
+	{"url_responses", "lang", "TEXT"},
+	{"url_responses", "open_graph", "TEXT"},
+	{"url_responses", "twitter", "TEXT"},
+	{"url_responses", "headings", "TEXT"},
+	{"url_responses", "json_ld", "TEXT"},
+	{"url_responses", "job_id", "INTEGER"},
+	{"url_responses", "tls", "TEXT"},
+	{"url_responses", "cert_not_after", "TIMESTAMP"},
+}
+
+// OpenSQLiteStore opens (creating if needed) the SQLite database at path and
+// returns a store writing to it. Bodies are compressed with compression.
+func OpenSQLiteStore(path string, compression Compression) (*SQLStore, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)")
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows a single writer; serialize through one connection
+	// instead of failing with "database is locked"
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create SQLite schema: %w", err)
+	}
+	if err := upgradeSQLite(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to upgrade SQLite schema: %w", err)
+	}
+	if _, err := db.Exec(sqliteIndexes); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create SQLite indexes: %w", err)
+	}
+	return newSQLStore(db, compression), nil
+}
+
+// upgradeSQLite adds the sqliteColumns missing from an existing database.
+func upgradeSQLite(db *sql.DB) error {
+	for _, c := range sqliteColumns {
+		var exists bool
+		err := db.QueryRow(`SELECT count(*) > 0 FROM pragma_table_info(?) WHERE name = ?`, c.table, c.column).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", c.table, c.column, c.definition)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
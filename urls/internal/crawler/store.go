@@ -0,0 +1,163 @@
+package crawler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+)
+
+// ResultStore persists fetched responses and the snapshots used to revalidate
+// them.
+type ResultStore interface {
+	// SaveResponse stores resp. Bodies are stored once per content hash, and
+	// unchanged responses reference the snapshot they revalidated instead.
+	SaveResponse(ctx context.Context, resp *Response) error
+	// LastSnapshot returns the most recent stored 2xx response of url that
+	// has a body, or nil if there is none.
+	LastSnapshot(ctx context.Context, url string) (*Snapshot, error)
+	// Snapshots returns up to limit stored 2xx responses of url that have a
+	// body, most recent first.
+	Snapshots(ctx context.Context, url string, limit int) ([]Snapshot, error)
+	// LoadSnapshot returns the stored response with the given id, following
+	// unchanged responses to the body they revalidated.
+	LoadSnapshot(ctx context.Context, id int64) (*Response, error)
+	// Close releases the resources held by the store.
+	Close() error
+}
+
+// StoreKind names a ResultStore implementation on the command line.
+type StoreKind string
+
+const (
+	PostgresStoreKind StoreKind = "postgres"
+	SQLiteStoreKind   StoreKind = "sqlite"
+	FileStoreKind     StoreKind = "file"
+)
+
+// ParseStoreKind validates a store name given on the command line.
+func ParseStoreKind(name string) (StoreKind, error) {
+	switch k := StoreKind(name); k {
+	case PostgresStoreKind, SQLiteStoreKind, FileStoreKind:
+		return k, nil
+	}
+	return "", fmt.Errorf("unknown store %q", name)
+}
+
+// SQLStore stores responses in the url_responses, url_contents and
+// url_content_chunks tables of a Postgres or SQLite database.
+type SQLStore struct {
+	db          *sql.DB
+	compression Compression
+}
+
+// NewPostgresStore returns a store writing to db, which must have been
+// migrated. Bodies are compressed with compression.
+func NewPostgresStore(db *sql.DB, compression Compression) *SQLStore {
+	return newSQLStore(db, compression)
+}
+
+func newSQLStore(db *sql.DB, compression Compression) *SQLStore {
+	if compression == "" {
+		compression = NoCompression
+	}
+	return &SQLStore{db: db, compression: compression}
+}
+
+// SaveResponse inserts the response and its metadata into the database.
+func (s *SQLStore) SaveResponse(ctx context.Context, resp *Response) error {
+	const insertURLResponseQuery = `
+		INSERT INTO url_responses
+			(url, content_hash, status_code, final_url, headers, content_type, content_length, fetch_duration_ms, fetched_at,
+			 etag, last_modified, unchanged_from, truncated,
+			 title, description, canonical_url, robots, lang, open_graph, twitter, headings, json_ld, tls, cert_not_after, job_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24, $25)`
+
+	headers, err := json.Marshal(resp.Header)
+	if err != nil {
+		return err
+	}
+
+	metadata, err := resp.Metadata.columns()
+	if err != nil {
+		return err
+	}
+	tlsColumns, err := resp.TLS.columns()
+	if err != nil {
+		return err
+	}
+
+	var contentHash, unchangedFrom, jobID interface{}
+	if resp.JobID != 0 {
+		jobID = resp.JobID
+	}
+	if resp.Unchanged != nil {
+		unchangedFrom = resp.Unchanged.ID
+	} else {
+		hash, err := s.saveContent(ctx, resp)
+		if err != nil {
+			log.Printf("failed to store content of URL %s: %v", resp.URL, err)
+			return err
+		}
+		contentHash = hash
+	}
+
+	args := []interface{}{
+		resp.URL, contentHash, resp.StatusCode, resp.FinalURL, string(headers),
+		resp.ContentType, resp.ContentLength, resp.Duration.Milliseconds(), resp.FetchedAt,
+		nullString(resp.ETag), nullString(resp.LastModified), unchangedFrom, resp.Truncated,
+	}
+	args = append(append(append(args, metadata...), tlsColumns...), jobID)
+	_, err = s.db.ExecContext(ctx, insertURLResponseQuery, args...)
+
+	if err != nil {
+		log.Printf("failed to insert URL %s into database: %v", resp.URL, err)
+		return err
+	}
+	return s.saveExtracted(ctx, resp)
+}
+
+// saveExtracted inserts the values extracted from resp into
+// extracted_fields.
+func (s *SQLStore) saveExtracted(ctx context.Context, resp *Response) error {
+	if len(resp.Extracted) == 0 {
+		return nil
+	}
+	const insertExtractedQuery = `
+		INSERT INTO extracted_fields (job_id, url, final_url, field, seq, value, fetched_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`
+
+	var jobID interface{}
+	if resp.JobID != 0 {
+		jobID = resp.JobID
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, v := range resp.Extracted {
+		if _, err := tx.ExecContext(ctx, insertExtractedQuery, jobID, resp.URL, resp.FinalURL, v.Field, v.Seq, v.Value, resp.FetchedAt); err != nil {
+			log.Printf("failed to insert fields extracted from URL %s into database: %v", resp.URL, err)
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// DB returns the underlying database.
+func (s *SQLStore) DB() *sql.DB {
+	return s.db
+}
+
+// Close closes the underlying database.
+func (s *SQLStore) Close() error {
+	return s.db.Close()
+}
+
+// nullString maps empty strings to NULL.
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
@@ -0,0 +1,89 @@
+package crawler
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStores(t *testing.T) {
+	stores := map[string]func(t *testing.T, dir string) ResultStore{
+		"sqlite": func(t *testing.T, dir string) ResultStore {
+			s, err := OpenSQLiteStore(filepath.Join(dir, "urls.db"), GzipCompression)
+			require.NoError(t, err)
+			return s
+		},
+		"file": func(t *testing.T, dir string) ResultStore {
+			s, err := OpenFileStore(dir, ZstdCompression)
+			require.NoError(t, err)
+			return s
+		},
+	}
+
+	for name, open := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			dir := t.TempDir()
+			store := open(t, dir)
+
+			snapshot, err := store.LastSnapshot(ctx, "https://example.com/")
+			assert.NoError(t, err)
+			assert.Nil(t, snapshot)
+
+			body := "<html>caf\xe9</html>"
+			resp := &Response{
+				URL: "https://example.com/", FinalURL: "https://example.com/", StatusCode: 200,
+				ContentType: "text/html; charset=iso-8859-1", ETag: `"v1"`, FetchedAt: time.Now().UTC(),
+				Body: []byte(body), ContentLength: int64(len(body)), Charset: "windows-1252", Text: "<html>café</html>",
+			}
+			require.NoError(t, store.SaveResponse(ctx, resp))
+
+			snapshot, err = store.LastSnapshot(ctx, "https://example.com/")
+			require.NoError(t, err)
+			require.NotNil(t, snapshot)
+			assert.Equal(t, `"v1"`, snapshot.ETag)
+
+			// A revalidated response points at the stored body
+			require.NoError(t, store.SaveResponse(ctx, &Response{
+				URL: "https://example.com/", FinalURL: "https://example.com/", StatusCode: 304,
+				ETag: `"v1"`, FetchedAt: time.Now().UTC(), Unchanged: snapshot,
+			}))
+			require.NoError(t, store.Close())
+
+			// Reopening keeps the stored snapshots
+			store = open(t, dir)
+			defer store.Close()
+			last, err := store.LastSnapshot(ctx, "https://example.com/")
+			require.NoError(t, err)
+			assert.Equal(t, snapshot, last)
+
+			snapshots, err := store.Snapshots(ctx, "https://example.com/", 10)
+			require.NoError(t, err)
+			require.Len(t, snapshots, 1)
+			assert.Equal(t, snapshot.ID, snapshots[0].ID)
+			assert.Equal(t, ContentHash([]byte(body)), snapshots[0].ContentHash)
+			assert.False(t, snapshots[0].FetchedAt.IsZero())
+
+			loaded, err := store.LoadSnapshot(ctx, snapshot.ID+1)
+			require.NoError(t, err)
+			assert.Equal(t, []byte(body), loaded.Body)
+			assert.Equal(t, ContentHash([]byte(body)), loaded.Hash)
+			assert.Equal(t, "windows-1252", loaded.Charset)
+			assert.Equal(t, "<html>café</html>", loaded.Text)
+			assert.Equal(t, "text/html; charset=iso-8859-1", loaded.ContentType)
+		})
+	}
+}
+
+func TestParseStoreKind(t *testing.T) {
+	kind, err := ParseStoreKind("sqlite")
+	assert.NoError(t, err)
+	assert.Equal(t, SQLiteStoreKind, kind)
+
+	_, err = ParseStoreKind("mysql")
+	assert.Error(t, err)
+}
@@ -0,0 +1,188 @@
+package crawler
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// TLSOptions configures how the crawler connects to HTTPS servers.
+type TLSOptions struct {
+	// RootCAs are trusted besides the system roots when set, see
+	// LoadRootCAs.
+	RootCAs *x509.CertPool
+	// ClientCerts are presented to the hosts they belong to.
+	ClientCerts []ClientCert
+	// MinVersion is the lowest TLS version accepted, e.g. tls.VersionTLS12.
+	// 0 leaves Go's default.
+	MinVersion uint16
+}
+
+// configured reports whether o changes anything from Go's defaults.
+func (o TLSOptions) configured() bool {
+	return o.RootCAs != nil || len(o.ClientCerts) > 0 || o.MinVersion != 0
+}
+
+// config returns the TLS configuration of connections to hosts without a
+// client certificate.
+func (o TLSOptions) config() *tls.Config {
+	return &tls.Config{RootCAs: o.RootCAs, MinVersion: o.MinVersion}
+}
+
+// ClientCert is the certificate presented to Host, matched like
+// HostAuth.Host.
+type ClientCert struct {
+	Host        string
+	Certificate tls.Certificate
+}
+
+// LoadRootCAs returns the system roots along with the certificates of the
+// given PEM files.
+func LoadRootCAs(paths []string) (*x509.CertPool, error) {
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no PEM certificates in %s", path)
+		}
+	}
+	return pool, nil
+}
+
+// ParseClientCert loads the client certificate described by spec, given
+// on the command line as host=cert.pem,key.pem.
+func ParseClientCert(spec string) (ClientCert, error) {
+	host, files, ok := strings.Cut(spec, "=")
+	certFile, keyFile, ok2 := strings.Cut(files, ",")
+	host = strings.ToLower(strings.TrimSpace(host))
+	if !ok || !ok2 || host == "" || certFile == "" || keyFile == "" {
+		return ClientCert{}, fmt.Errorf("expected host=cert.pem,key.pem, got %q", spec)
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return ClientCert{}, fmt.Errorf("failed to load client certificate of %s: %w", host, err)
+	}
+	return ClientCert{Host: host, Certificate: cert}, nil
+}
+
+// ParseTLSVersion validates a minimum TLS version given on the command
+// line, e.g. "1.2". An empty version is 0.
+func ParseTLSVersion(version string) (uint16, error) {
+	switch strings.TrimPrefix(strings.ToLower(version), "tls") {
+	case "":
+		return 0, nil
+	case "1.0", "10":
+		return tls.VersionTLS10, nil
+	case "1.1", "11":
+		return tls.VersionTLS11, nil
+	case "1.2", "12":
+		return tls.VersionTLS12, nil
+	case "1.3", "13":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("unknown TLS version %q, expected 1.0, 1.1, 1.2 or 1.3", version)
+}
+
+// hostTransport sends requests through the transport of the first route
+// matching their host, or through fallback.
+type hostTransport struct {
+	routes   []hostRoute
+	fallback http.RoundTripper
+}
+
+type hostRoute struct {
+	host      string
+	transport http.RoundTripper
+}
+
+func (t *hostTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for _, route := range t.routes {
+		if hostMatches(route.host, req.URL) {
+			return route.transport.RoundTrip(req)
+		}
+	}
+	return t.fallback.RoundTrip(req)
+}
+
+// TLSInfo describes the connection a response was received over.
+type TLSInfo struct {
+	Version string `json:"version"`
+	// Certificates is the chain sent by the server, leaf first.
+	Certificates []Certificate `json:"certificates"`
+}
+
+// Certificate describes a certificate of a server's chain.
+type Certificate struct {
+	Subject      string    `json:"subject"`
+	Issuer       string    `json:"issuer"`
+	DNSNames     []string  `json:"dns_names,omitempty"`
+	IPAddresses  []string  `json:"ip_addresses,omitempty"`
+	SerialNumber string    `json:"serial_number"`
+	NotBefore    time.Time `json:"not_before"`
+	NotAfter     time.Time `json:"not_after"`
+}
+
+// newTLSInfo describes state, or returns nil for plain HTTP.
+func newTLSInfo(state *tls.ConnectionState) *TLSInfo {
+	if state == nil {
+		return nil
+	}
+	info := &TLSInfo{Version: tls.VersionName(state.Version)}
+	for _, cert := range state.PeerCertificates {
+		c := Certificate{
+			Subject:      cert.Subject.String(),
+			Issuer:       cert.Issuer.String(),
+			DNSNames:     cert.DNSNames,
+			SerialNumber: cert.SerialNumber.String(),
+			NotBefore:    cert.NotBefore.UTC(),
+			NotAfter:     cert.NotAfter.UTC(),
+		}
+		for _, ip := range cert.IPAddresses {
+			c.IPAddresses = append(c.IPAddresses, ip.String())
+		}
+		info.Certificates = append(info.Certificates, c)
+	}
+	return info
+}
+
+// NotAfter returns when the first certificate of the chain to expire does,
+// or the zero time without certificates.
+func (t *TLSInfo) NotAfter() time.Time {
+	var notAfter time.Time
+	if t == nil {
+		return notAfter
+	}
+	for _, c := range t.Certificates {
+		if notAfter.IsZero() || c.NotAfter.Before(notAfter) {
+			notAfter = c.NotAfter
+		}
+	}
+	return notAfter
+}
+
+// columns returns the tls and cert_not_after values of url_responses.
+func (t *TLSInfo) columns() ([]interface{}, error) {
+	if t == nil {
+		return []interface{}{nil, nil}, nil
+	}
+	data, err := json.Marshal(t)
+	if err != nil {
+		return nil, err
+	}
+	var notAfter interface{}
+	if n := t.NotAfter(); !n.IsZero() {
+		notAfter = n
+	}
+	return []interface{}{string(data), notAfter}, nil
+}
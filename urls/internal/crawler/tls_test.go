@@ -0,0 +1,146 @@
+package crawler
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writePEM writes a PEM block of the given type to a file in dir.
+func writePEM(t *testing.T, dir, name, blockType string, der []byte) string {
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600))
+	return path
+}
+
+// clientCertFiles writes a self-signed client certificate and its key to
+// dir, and returns the certificate for servers to trust.
+func clientCertFiles(t *testing.T, dir string) (*x509.Certificate, string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "crawler"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	return cert, writePEM(t, dir, "client.crt", "CERTIFICATE", der), writePEM(t, dir, "client.key", "EC PRIVATE KEY", keyDER)
+}
+
+func TestTLSRootCAs(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	caFile := writePEM(t, t.TempDir(), "ca.pem", "CERTIFICATE", server.Certificate().Raw)
+	ctx := context.Background()
+
+	// Not trusted by default
+	_, err := New(nil, Options{IgnoreRobots: true}).FetchURL(ctx, server.URL)
+	assert.Error(t, err)
+
+	roots, err := LoadRootCAs([]string{caFile})
+	require.NoError(t, err)
+	store, err := OpenSQLiteStore(filepath.Join(t.TempDir(), "urls.db"), NoCompression)
+	require.NoError(t, err)
+	defer store.Close()
+	c := New(store, Options{IgnoreRobots: true, Client: ClientOptions{TLS: TLSOptions{RootCAs: roots, MinVersion: tls.VersionTLS12}}})
+
+	result := c.Visit(ctx, server.URL)
+	require.NoError(t, result.Err)
+	notAfter := server.Certificate().NotAfter.UTC()
+	assert.Equal(t, notAfter, result.CertNotAfter)
+	assert.Equal(t, server.URL, result.FinalURL)
+
+	var info string
+	var stored time.Time
+	require.NoError(t, store.DB().QueryRow(`SELECT tls, cert_not_after FROM url_responses WHERE id = 1`).Scan(&info, &stored))
+	assert.True(t, notAfter.Equal(stored))
+	assert.Contains(t, info, `"version":"TLS 1.3"`)
+	assert.Contains(t, info, `"issuer":"O=Acme Co"`)
+	assert.Contains(t, info, `"dns_names":["example.com"`)
+	assert.Contains(t, info, `"ip_addresses":["127.0.0.1","::1"]`)
+
+	_, err = LoadRootCAs([]string{filepath.Join(t.TempDir(), "missing.pem")})
+	assert.Error(t, err)
+	notPEM := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(notPEM, []byte("not a certificate"), 0o600))
+	_, err = LoadRootCAs([]string{notPEM})
+	assert.Error(t, err)
+}
+
+func TestTLSClientCert(t *testing.T) {
+	dir := t.TempDir()
+	clientCert, certFile, keyFile := clientCertFiles(t, dir)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs, MaxVersion: tls.VersionTLS12}
+	server.StartTLS()
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+	cert, err := ParseClientCert("127.0.0.1=" + certFile + "," + keyFile)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	resp, err := New(nil, Options{IgnoreRobots: true, Client: ClientOptions{TLS: TLSOptions{RootCAs: roots, ClientCerts: []ClientCert{cert}}}}).
+		FetchURL(ctx, server.URL)
+	require.NoError(t, err)
+	assert.Equal(t, "crawler", string(resp.Body))
+	assert.Equal(t, "TLS 1.2", resp.TLS.Version)
+
+	// The certificate is only presented to its host
+	other, err := ParseClientCert("other.example.com=" + certFile + "," + keyFile)
+	require.NoError(t, err)
+	_, err = New(nil, Options{IgnoreRobots: true, Client: ClientOptions{TLS: TLSOptions{RootCAs: roots, ClientCerts: []ClientCert{other}}}}).
+		FetchURL(ctx, server.URL)
+	assert.Error(t, err)
+
+	// The server does not speak TLS 1.3
+	_, err = New(nil, Options{IgnoreRobots: true, Client: ClientOptions{TLS: TLSOptions{RootCAs: roots, ClientCerts: []ClientCert{cert}, MinVersion: tls.VersionTLS13}}}).
+		FetchURL(ctx, server.URL)
+	assert.Error(t, err)
+
+	for _, spec := range []string{"127.0.0.1", "=" + certFile + "," + keyFile, "127.0.0.1=" + certFile, "127.0.0.1=" + keyFile + "," + certFile} {
+		_, err := ParseClientCert(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestParseTLSVersion(t *testing.T) {
+	for version, expected := range map[string]uint16{"": 0, "1.0": tls.VersionTLS10, "1.2": tls.VersionTLS12, "TLS1.3": tls.VersionTLS13, "13": tls.VersionTLS13} {
+		got, err := ParseTLSVersion(version)
+		assert.NoError(t, err, version)
+		assert.Equal(t, expected, got, version)
+	}
+	_, err := ParseTLSVersion("1.4")
+	assert.Error(t, err)
+}
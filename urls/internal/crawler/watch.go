@@ -0,0 +1,133 @@
+package crawler
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Schedule tells when a watched URL is due next.
+type Schedule interface {
+	Next(time.Time) time.Time
+}
+
+// ParseSchedule parses an interval such as "15m" or a cron expression: five
+// fields, a descriptor like "@daily", or "@every 1h".
+func ParseSchedule(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if d, err := time.ParseDuration(spec); err == nil {
+		if d < time.Second {
+			return nil, fmt.Errorf("interval %v is shorter than a second", d)
+		}
+		return cron.Every(d), nil
+	}
+	schedule, err := cron.ParseStandard(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule %q: %w", spec, err)
+	}
+	return schedule, nil
+}
+
+// Target is a URL fetched again and again on a schedule.
+type Target struct {
+	URL      string
+	Schedule Schedule
+}
+
+// Watch fetches every target right away and then whenever its schedule is
+// due, until ctx is done. visit does the fetching, like Crawler.Visit, and
+// one Result is sent per fetch. A target is never fetched twice at the same
+// time: when a fetch overruns, the next one is scheduled from its end.
+func (p *Pool) Watch(ctx context.Context, targets []Target, visit func(ctx context.Context, url string) Result) <-chan Result {
+	results := make(chan Result, p.workers)
+	finished := make(chan struct{})
+	workCtx := p.workContext(ctx, finished)
+
+	go func() {
+		queue := make(watchQueue, 0, len(targets))
+		now := time.Now()
+		for _, t := range targets {
+			queue = append(queue, &watched{target: t, next: now})
+		}
+		heap.Init(&queue)
+
+		done := make(chan *watched, len(targets))
+		var wg sync.WaitGroup
+		timer := time.NewTimer(0)
+		defer timer.Stop()
+
+		for {
+			if len(queue) > 0 {
+				timer.Reset(time.Until(queue[0].next))
+			}
+
+			select {
+			case <-ctx.Done():
+				wg.Wait()
+				close(finished)
+				close(results)
+				return
+			case w := <-done:
+				w.next = w.target.Schedule.Next(time.Now())
+				heap.Push(&queue, w)
+			case <-timer.C:
+				for len(queue) > 0 && !queue[0].next.After(time.Now()) {
+					w := heap.Pop(&queue).(*watched)
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						// Shutting down while waiting for a slot
+						releaseWorker, err := p.busy.Acquire(ctx, "")
+						if err != nil {
+							return
+						}
+						defer releaseWorker()
+						release, err := p.hosts.Acquire(ctx, w.target.URL)
+						if err != nil {
+							return
+						}
+						if ctx.Err() != nil {
+							release()
+							return
+						}
+						result := visit(workCtx, w.target.URL)
+						release()
+						results <- result
+						done <- w
+					}()
+				}
+			}
+		}
+	}()
+
+	return results
+}
+
+// watched is a target along with when it is due next.
+type watched struct {
+	target Target
+	next   time.Time
+}
+
+// watchQueue is a min-heap of targets ordered by when they are due.
+type watchQueue []*watched
+
+func (q watchQueue) Len() int           { return len(q) }
+func (q watchQueue) Less(i, j int) bool { return q[i].next.Before(q[j].next) }
+func (q watchQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+
+func (q *watchQueue) Push(x any) {
+	*q = append(*q, x.(*watched))
+}
+
+func (q *watchQueue) Pop() any {
+	old := *q
+	w := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return w
+}
@@ -0,0 +1,70 @@
+package crawler
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSchedule(t *testing.T) {
+	start := time.Date(2024, 5, 1, 10, 7, 0, 0, time.UTC)
+
+	tests := []struct {
+		spec     string
+		expected time.Time
+	}{
+		{spec: "15m", expected: start.Add(15 * time.Minute)},
+		{spec: "@every 1h", expected: start.Add(time.Hour)},
+		{spec: "*/10 * * * *", expected: time.Date(2024, 5, 1, 10, 10, 0, 0, time.UTC)},
+		{spec: "@daily", expected: time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, testCase := range tests {
+		t.Run(testCase.spec, func(t *testing.T) {
+			schedule, err := ParseSchedule(testCase.spec)
+			assert.NoError(t, err)
+			assert.Equal(t, testCase.expected, schedule.Next(start))
+		})
+	}
+
+	_, err := ParseSchedule("every tuesday")
+	assert.Error(t, err)
+	_, err = ParseSchedule("10ms")
+	assert.Error(t, err)
+}
+
+// every is a Schedule with intervals shorter than ParseSchedule allows.
+type every time.Duration
+
+func (e every) Next(t time.Time) time.Time { return t.Add(time.Duration(e)) }
+
+func TestPoolWatch(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	var mu sync.Mutex
+	fetches := map[string]int{}
+	pool := NewPool(2, 1)
+	targets := []Target{
+		{URL: "https://example.com/fast", Schedule: every(20 * time.Millisecond)},
+		{URL: "https://example.org/slow", Schedule: every(time.Hour)},
+	}
+	results := pool.Watch(ctx, targets, func(ctx context.Context, url string) Result {
+		mu.Lock()
+		fetches[url]++
+		mu.Unlock()
+		return Result{URL: url}
+	})
+
+	count := 0
+	for result := range results {
+		assert.NoError(t, result.Err)
+		count++
+	}
+
+	assert.Equal(t, 1, fetches["https://example.org/slow"])
+	assert.GreaterOrEqual(t, fetches["https://example.com/fast"], 4)
+	assert.Equal(t, fetches["https://example.org/slow"]+fetches["https://example.com/fast"], count)
+}
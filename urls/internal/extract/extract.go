@@ -0,0 +1,231 @@
+// Package extract pulls named fields out of fetched pages according to
+// user-defined rules.
+//
+// A rules file is a JSON array of rules. Each rule applies to the URLs
+// matching its regular expression and lists the fields to extract:
+//
+//	[
+//	  {
+//	    "url": "^https://shop\\.example\\.com/products/",
+//	    "fields": [
+//	      {"name": "price", "css": ".price", "regex": "[0-9]+\\.[0-9]{2}"},
+//	      {"name": "image", "css": "img.product", "attr": "src", "all": true},
+//	      {"name": "version", "xpath": "//dl/dt[.='Version']/following-sibling::dd[1]"},
+//	      {"name": "released", "regex": "Released on ([0-9]{4}-[0-9]{2}-[0-9]{2})"}
+//	    ]
+//	  }
+//	]
+//
+// A field selects elements with either css or xpath, taking their text or
+// the attribute attr. A regex narrows the selected text down to its first
+// capture group, or to the whole match without groups; on its own it is
+// matched against the page. Only the first value is kept unless all is set.
+package extract
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/andybalholm/cascadia"
+	"github.com/antchfx/htmlquery"
+	"github.com/antchfx/xpath"
+	"golang.org/x/net/html"
+)
+
+// Rule lists the fields extracted from the URLs matching URL.
+type Rule struct {
+	URL    string  `json:"url"`
+	Fields []Field `json:"fields"`
+
+	pattern *regexp.Regexp
+}
+
+// Field is a named value extracted from a page.
+type Field struct {
+	Name  string `json:"name"`
+	CSS   string `json:"css,omitempty"`
+	XPath string `json:"xpath,omitempty"`
+	Attr  string `json:"attr,omitempty"`
+	Regex string `json:"regex,omitempty"`
+	All   bool   `json:"all,omitempty"`
+
+	css   cascadia.Sel
+	xpath *xpath.Expr
+	regex *regexp.Regexp
+}
+
+// Value is a value extracted from a page. Seq numbers the values of a field
+// extracted with all, from 0.
+type Value struct {
+	Field string `json:"field"`
+	Value string `json:"value"`
+	Seq   int    `json:"seq"`
+}
+
+// Rules are the compiled rules of a rules file.
+type Rules struct {
+	rules []Rule
+}
+
+// Load reads and compiles the rules file at path.
+func Load(path string) (*Rules, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules []Rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return Compile(rules)
+}
+
+// Compile validates rules and compiles their patterns.
+func Compile(rules []Rule) (*Rules, error) {
+	for i := range rules {
+		r := &rules[i]
+		pattern, err := regexp.Compile(r.URL)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: invalid url pattern %q: %w", i+1, r.URL, err)
+		}
+		r.pattern = pattern
+
+		for j := range r.Fields {
+			if err := r.Fields[j].compile(); err != nil {
+				return nil, fmt.Errorf("rule %d: %w", i+1, err)
+			}
+		}
+	}
+	return &Rules{rules: rules}, nil
+}
+
+func (f *Field) compile() error {
+	if f.Name == "" {
+		return fmt.Errorf("field without a name")
+	}
+	switch {
+	case f.CSS != "" && f.XPath != "":
+		return fmt.Errorf("field %s: css and xpath are exclusive", f.Name)
+	case f.CSS == "" && f.XPath == "" && f.Regex == "":
+		return fmt.Errorf("field %s: one of css, xpath or regex is required", f.Name)
+	case f.CSS == "" && f.XPath == "" && f.Attr != "":
+		return fmt.Errorf("field %s: attr needs css or xpath", f.Name)
+	}
+
+	var err error
+	if f.CSS != "" {
+		if f.css, err = cascadia.Parse(f.CSS); err != nil {
+			return fmt.Errorf("field %s: invalid css selector: %w", f.Name, err)
+		}
+	}
+	if f.XPath != "" {
+		if f.xpath, err = xpath.Compile(f.XPath); err != nil {
+			return fmt.Errorf("field %s: invalid xpath: %w", f.Name, err)
+		}
+	}
+	if f.Regex != "" {
+		if f.regex, err = regexp.Compile(f.Regex); err != nil {
+			return fmt.Errorf("field %s: invalid regex: %w", f.Name, err)
+		}
+	}
+	return nil
+}
+
+// Matches reports whether any rule applies to url, so that pages no rule
+// applies to need not be parsed.
+func (rs *Rules) Matches(url string) bool {
+	for _, r := range rs.rules {
+		if r.pattern.MatchString(url) {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply extracts the fields of the rules matching url from body. Selectors
+// only apply to HTML pages; fields that find nothing are left out.
+func (rs *Rules) Apply(url string, body []byte, isHTML bool) ([]Value, error) {
+	var doc *html.Node
+	var values []Value
+	for _, r := range rs.rules {
+		if !r.pattern.MatchString(url) {
+			continue
+		}
+		for _, f := range r.Fields {
+			if (f.css != nil || f.xpath != nil) && doc == nil {
+				if !isHTML {
+					continue
+				}
+				var err error
+				if doc, err = html.Parse(bytes.NewReader(body)); err != nil {
+					return nil, err
+				}
+			}
+			for i, v := range f.extract(doc, body) {
+				values = append(values, Value{Field: f.Name, Value: v, Seq: i})
+			}
+		}
+	}
+	return values, nil
+}
+
+// extract returns the values of f in the page, parsed into doc when a
+// selector is used.
+func (f *Field) extract(doc *html.Node, body []byte) []string {
+	var texts []string
+	switch {
+	case f.css != nil:
+		for _, n := range cascadia.QueryAll(doc, f.css) {
+			texts = append(texts, f.nodeValue(n))
+		}
+	case f.xpath != nil:
+		for _, n := range htmlquery.QuerySelectorAll(doc, f.xpath) {
+			texts = append(texts, f.nodeValue(n))
+		}
+	default:
+		texts = []string{string(body)}
+	}
+
+	var values []string
+	for _, text := range texts {
+		if f.regex != nil {
+			matches := f.regex.FindAllStringSubmatch(text, -1)
+			if !f.All && len(matches) > 1 {
+				matches = matches[:1]
+			}
+			for _, m := range matches {
+				value := m[0]
+				if len(m) > 1 {
+					value = m[1]
+				}
+				values = appendValue(values, value)
+			}
+		} else {
+			values = appendValue(values, text)
+		}
+		if !f.All && len(values) > 0 {
+			return values[:1]
+		}
+	}
+	return values
+}
+
+// nodeValue returns the attribute Attr of n, or its text.
+func (f *Field) nodeValue(n *html.Node) string {
+	if f.Attr != "" {
+		return htmlquery.SelectAttr(n, f.Attr)
+	}
+	return htmlquery.InnerText(n)
+}
+
+// appendValue appends v with whitespace collapsed, unless it is blank.
+func appendValue(values []string, v string) []string {
+	if v = strings.Join(strings.Fields(v), " "); v != "" {
+		values = append(values, v)
+	}
+	return values
+}
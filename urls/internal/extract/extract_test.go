@@ -0,0 +1,69 @@
+package extract
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const product = `<html><body>
+  <h1>Widget</h1>
+  <p class="price">Now only EUR 19.99 <s>24.99</s></p>
+  <img class="product" src="/a.png"><img class="product" src="/b.png">
+  <dl><dt>Version</dt><dd> 2.4.1 </dd><dt>Size</dt><dd>XL</dd></dl>
+  <p>Released on 2024-03-01, updated on 2024-05-02</p>
+</body></html>`
+
+func TestApply(t *testing.T) {
+	rules, err := Compile([]Rule{
+		{URL: `^https://shop\.example\.com/products/`, Fields: []Field{
+			{Name: "price", CSS: ".price", Regex: `[0-9]+\.[0-9]{2}`},
+			{Name: "image", CSS: "img.product", Attr: "src", All: true},
+			{Name: "version", XPath: "//dl/dt[.='Version']/following-sibling::dd[1]"},
+			{Name: "dates", Regex: `on ([0-9]{4}-[0-9]{2}-[0-9]{2})`, All: true},
+			{Name: "missing", CSS: ".discount"},
+		}},
+		{URL: `/blog/`, Fields: []Field{{Name: "title", CSS: "h1"}}},
+	})
+	require.NoError(t, err)
+
+	assert.False(t, rules.Matches("https://shop.example.com/cart"))
+	assert.True(t, rules.Matches("https://shop.example.com/products/widget"))
+
+	values, err := rules.Apply("https://shop.example.com/products/widget", []byte(product), true)
+	assert.NoError(t, err)
+	assert.Equal(t, []Value{
+		{Field: "price", Value: "19.99"},
+		{Field: "image", Value: "/a.png"},
+		{Field: "image", Value: "/b.png", Seq: 1},
+		{Field: "version", Value: "2.4.1"},
+		{Field: "dates", Value: "2024-03-01"},
+		{Field: "dates", Value: "2024-05-02", Seq: 1},
+	}, values)
+
+	// Selectors need HTML, regexes apply to any body
+	values, err = rules.Apply("https://shop.example.com/products/widget.txt", []byte("Released on 2024-03-01"), false)
+	assert.NoError(t, err)
+	assert.Equal(t, []Value{{Field: "dates", Value: "2024-03-01"}}, values)
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	require.NoError(t, os.WriteFile(path, []byte(`[{"url": ".", "fields": [{"name": "title", "xpath": "//title"}]}]`), 0o644))
+	_, err := Load(path)
+	assert.NoError(t, err)
+
+	for name, rules := range map[string][]Rule{
+		"bad url pattern":  {{URL: "(", Fields: []Field{{Name: "x", Regex: "x"}}}},
+		"no name":          {{URL: ".", Fields: []Field{{CSS: "h1"}}}},
+		"css and xpath":    {{URL: ".", Fields: []Field{{Name: "x", CSS: "h1", XPath: "//h1"}}}},
+		"nothing to match": {{URL: ".", Fields: []Field{{Name: "x"}}}},
+		"bad xpath":        {{URL: ".", Fields: []Field{{Name: "x", XPath: "//["}}}},
+	} {
+		_, err := Compile(rules)
+		assert.Error(t, err, name)
+	}
+}
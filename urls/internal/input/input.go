@@ -0,0 +1,302 @@
+package input
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Format is the format of a URL list.
+type Format string
+
+const (
+	Auto  Format = "auto"
+	Text  Format = "text"
+	CSV   Format = "csv"
+	JSONL Format = "jsonl"
+)
+
+// Entry is a URL to crawl read from an input file.
+type Entry struct {
+	URL      string   `json:"url"`
+	Tags     []string `json:"tags,omitempty"`
+	Priority int      `json:"priority,omitempty"`
+	// Schedule is how often the URL is fetched in watch mode: an interval
+	// such as "15m" or a cron expression.
+	Schedule string `json:"schedule,omitempty"`
+	// Line is the line (or CSV record) the entry was read from.
+	Line int `json:"-"`
+}
+
+// LineError reports an input line that was skipped.
+type LineError struct {
+	Line int
+	Err  error
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *LineError) Unwrap() error {
+	return e.Err
+}
+
+// ParseFormat validates a format name given on the command line.
+func ParseFormat(name string) (Format, error) {
+	switch f := Format(strings.ToLower(name)); f {
+	case "", Auto:
+		return Auto, nil
+	case Text, CSV, JSONL:
+		return f, nil
+	case "txt":
+		return Text, nil
+	case "json", "ndjson":
+		return JSONL, nil
+	}
+	return "", fmt.Errorf("unknown input format %q", name)
+}
+
+// DetectFormat picks the format of path from its extension, defaulting to
+// newline-delimited text.
+func DetectFormat(path string) Format {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return CSV
+	case ".jsonl", ".ndjson", ".json":
+		return JSONL
+	}
+	return Text
+}
+
+// ReadFile reads the URL list at path, or from stdin when path is "-".
+func ReadFile(path string, format Format) ([]Entry, []error, error) {
+	if format == Auto {
+		format = DetectFormat(path)
+	}
+
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	return Read(r, format)
+}
+
+// Read parses a URL list. Blank lines and lines starting with # are ignored,
+// and lines that do not hold a valid http(s) URL are returned as LineErrors
+// instead of entries. Entries are ordered by descending priority, keeping
+// the input order for equal priorities.
+func Read(r io.Reader, format Format) ([]Entry, []error, error) {
+	var entries []Entry
+	var invalid []error
+	var err error
+
+	switch format {
+	case Text, Auto:
+		entries, invalid, err = readText(r)
+	case CSV:
+		entries, invalid, err = readCSV(r)
+	case JSONL:
+		entries, invalid, err = readJSONL(r)
+	default:
+		return nil, nil, fmt.Errorf("unknown input format %q", format)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Priority > entries[j].Priority
+	})
+	return entries, invalid, nil
+}
+
+// URLs returns the URLs of entries.
+func URLs(entries []Entry) []string {
+	urls := make([]string, 0, len(entries))
+	for _, e := range entries {
+		urls = append(urls, e.URL)
+	}
+	return urls
+}
+
+// FromList turns a comma-separated --urls value into entries.
+func FromList(list string) ([]Entry, []error) {
+	var entries []Entry
+	var invalid []error
+	for i, raw := range strings.Split(list, ",") {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		if err := Validate(raw); err != nil {
+			invalid = append(invalid, &LineError{Line: i + 1, Err: err})
+			continue
+		}
+		entries = append(entries, Entry{URL: raw, Line: i + 1})
+	}
+	return entries, invalid
+}
+
+// Validate checks that raw is an absolute http(s) URL.
+func Validate(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported URL %q: scheme must be http or https", raw)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("invalid URL %q: missing host", raw)
+	}
+	return nil
+}
+
+func skip(line string) bool {
+	line = strings.TrimSpace(line)
+	return line == "" || strings.HasPrefix(line, "#")
+}
+
+func readText(r io.Reader) ([]Entry, []error, error) {
+	var entries []Entry
+	var invalid []error
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if skip(text) {
+			continue
+		}
+		// URLs cannot hold blanks, anything after the first one is a schedule
+		raw, schedule := strings.TrimSpace(text), ""
+		if i := strings.IndexAny(raw, " \t"); i >= 0 {
+			raw, schedule = raw[:i], strings.TrimSpace(raw[i+1:])
+		}
+		if err := Validate(raw); err != nil {
+			invalid = append(invalid, &LineError{Line: line, Err: err})
+			continue
+		}
+		entries = append(entries, Entry{URL: raw, Schedule: schedule, Line: line})
+	}
+	return entries, invalid, scanner.Err()
+}
+
+func readJSONL(r io.Reader) ([]Entry, []error, error) {
+	var entries []Entry
+	var invalid []error
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if skip(text) {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal([]byte(text), &e); err != nil {
+			invalid = append(invalid, &LineError{Line: line, Err: err})
+			continue
+		}
+		e.URL = strings.TrimSpace(e.URL)
+		if err := Validate(e.URL); err != nil {
+			invalid = append(invalid, &LineError{Line: line, Err: err})
+			continue
+		}
+		e.Line = line
+		entries = append(entries, e)
+	}
+	return entries, invalid, scanner.Err()
+}
+
+// readCSV reads records with a header row naming a "url" column and optional
+// "tags" (separated by ";" or "|"), "priority" and "schedule" columns. Without
+// such a header the first column holds the URL.
+func readCSV(r io.Reader) ([]Entry, []error, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil, nil
+	}
+
+	urlCol, tagsCol, priorityCol, scheduleCol := 0, -1, -1, -1
+	start := 0
+	for i, name := range records[0] {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "url":
+			urlCol, start = i, 1
+		case "tags":
+			tagsCol = i
+		case "priority":
+			priorityCol = i
+		case "schedule", "interval":
+			scheduleCol = i
+		}
+	}
+	if start == 0 {
+		tagsCol, priorityCol, scheduleCol = -1, -1, -1
+	}
+
+	var entries []Entry
+	var invalid []error
+	for i, record := range records[start:] {
+		line := start + i + 1
+		if urlCol >= len(record) || skip(record[urlCol]) {
+			continue
+		}
+
+		e := Entry{URL: strings.TrimSpace(record[urlCol]), Line: line}
+		if err := Validate(e.URL); err != nil {
+			invalid = append(invalid, &LineError{Line: line, Err: err})
+			continue
+		}
+		if tagsCol >= 0 && tagsCol < len(record) {
+			e.Tags = splitTags(record[tagsCol])
+		}
+		if priorityCol >= 0 && priorityCol < len(record) && strings.TrimSpace(record[priorityCol]) != "" {
+			p, err := strconv.Atoi(strings.TrimSpace(record[priorityCol]))
+			if err != nil {
+				invalid = append(invalid, &LineError{Line: line, Err: errors.New("invalid priority: " + record[priorityCol])})
+				continue
+			}
+			e.Priority = p
+		}
+		if scheduleCol >= 0 && scheduleCol < len(record) {
+			e.Schedule = strings.TrimSpace(record[scheduleCol])
+		}
+		entries = append(entries, e)
+	}
+	return entries, invalid, nil
+}
+
+func splitTags(s string) []string {
+	var tags []string
+	for _, tag := range strings.FieldsFunc(s, func(r rune) bool { return r == ';' || r == '|' }) {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
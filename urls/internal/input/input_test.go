@@ -0,0 +1,105 @@
+package input
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRead(t *testing.T) {
+	tests := []struct {
+		name            string
+		format          Format
+		input           string
+		expectedURLs    []string
+		expectedInvalid []int
+	}{
+		{
+			name:   "Text",
+			format: Text,
+			input: `# docs to snapshot
+https://example.com/a,b
+
+  https://example.com/c
+not a url
+ftp://example.com/file
+`,
+			expectedURLs:    []string{"https://example.com/a,b", "https://example.com/c"},
+			expectedInvalid: []int{5, 6},
+		},
+		{
+			name:   "CSV with header",
+			format: CSV,
+			input: `name,url,tags,priority
+low,https://example.com/low,docs;api,1
+high,"https://example.com/high?a=1,2",docs,5
+bad,example.com,,
+mid,https://example.com/mid,,
+`,
+			expectedURLs:    []string{"https://example.com/high?a=1,2", "https://example.com/low", "https://example.com/mid"},
+			expectedInvalid: []int{4},
+		},
+		{
+			name:         "CSV without header",
+			format:       CSV,
+			input:        "https://example.com/a,x\nhttps://example.com/b,y\n",
+			expectedURLs: []string{"https://example.com/a", "https://example.com/b"},
+		},
+		{
+			name:   "JSONL",
+			format: JSONL,
+			input: `{"url": "https://example.com/a"}
+# comment
+{"url": "https://example.com/b", "priority": 2, "tags": ["x"]}
+{"url": 
+{"url": "/relative"}
+`,
+			expectedURLs:    []string{"https://example.com/b", "https://example.com/a"},
+			expectedInvalid: []int{4, 5},
+		},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			entries, invalid, err := Read(strings.NewReader(testCase.input), testCase.format)
+
+			assert.NoError(t, err)
+			assert.Equal(t, testCase.expectedURLs, URLs(entries))
+
+			var lines []int
+			for _, err := range invalid {
+				lines = append(lines, err.(*LineError).Line)
+			}
+			assert.Equal(t, testCase.expectedInvalid, lines)
+		})
+	}
+}
+
+func TestReadCSVTags(t *testing.T) {
+	entries, _, err := Read(strings.NewReader("url,tags\nhttps://example.com/,docs; api | v2\n"), CSV)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"docs", "api", "v2"}, entries[0].Tags)
+}
+
+func TestReadSchedules(t *testing.T) {
+	entries, _, err := Read(strings.NewReader("https://example.com/a 15m\nhttps://example.com/b\t*/5 * * * *\nhttps://example.com/c\n"), Text)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"15m", "*/5 * * * *", ""}, []string{entries[0].Schedule, entries[1].Schedule, entries[2].Schedule})
+
+	entries, _, err = Read(strings.NewReader("url,interval\nhttps://example.com/,1h\n"), CSV)
+	assert.NoError(t, err)
+	assert.Equal(t, "1h", entries[0].Schedule)
+
+	entries, _, err = Read(strings.NewReader(`{"url": "https://example.com/", "schedule": "@daily"}`), JSONL)
+	assert.NoError(t, err)
+	assert.Equal(t, "@daily", entries[0].Schedule)
+}
+
+func TestDetectFormat(t *testing.T) {
+	assert.Equal(t, CSV, DetectFormat("urls.CSV"))
+	assert.Equal(t, JSONL, DetectFormat("urls.jsonl"))
+	assert.Equal(t, Text, DetectFormat("urls.txt"))
+	assert.Equal(t, Text, DetectFormat("-"))
+}
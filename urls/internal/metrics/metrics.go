@@ -0,0 +1,214 @@
+// Package metrics collects Prometheus metrics about fetching and storing
+// URLs, served on /metrics by long-running processes and summarized at the
+// end of one-shot runs.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// ErrorClass is the status class of fetches that got no HTTP response.
+const ErrorClass = "error"
+
+// Metrics holds the collectors of a process. A nil *Metrics records nothing,
+// so that callers do not have to check whether metrics are enabled.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	fetches       *prometheus.CounterVec
+	bytes         *prometheus.CounterVec
+	retries       *prometheus.CounterVec
+	fetchDuration prometheus.Histogram
+	storeDuration prometheus.Histogram
+	queueDepth    prometheus.Gauge
+}
+
+// New returns metrics registered with a registry of their own, along with
+// the Go runtime and process collectors.
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		fetches: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "urls_fetches_total",
+			Help: "HTTP fetches by status class (2xx, 4xx, ... or error when there was no response) and host.",
+		}, []string{"status_class", "host"}),
+		bytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "urls_downloaded_bytes_total",
+			Help: "Bytes of response bodies downloaded, by host.",
+		}, []string{"host"}),
+		retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "urls_retries_total",
+			Help: "Fetches retried after a transient failure, by host.",
+		}, []string{"host"}),
+		fetchDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "urls_fetch_duration_seconds",
+			Help:    "Time taken by a single HTTP fetch, including reading the body.",
+			Buckets: prometheus.DefBuckets,
+		}),
+		storeDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "urls_store_duration_seconds",
+			Help:    "Time taken to insert a response into the store.",
+			Buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+		}),
+		queueDepth: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "urls_queue_depth",
+			Help: "URLs queued and waiting for a worker.",
+		}),
+	}
+	m.registry.MustRegister(m.fetches, m.bytes, m.retries, m.fetchDuration, m.storeDuration, m.queueDepth,
+		collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	return m
+}
+
+// Fetched records an HTTP fetch of rawURL. status is 0 when no response was
+// received.
+func (m *Metrics) Fetched(rawURL string, status int, bytes int64, d time.Duration) {
+	if m == nil {
+		return
+	}
+	host := hostOf(rawURL)
+	m.fetches.WithLabelValues(StatusClass(status), host).Inc()
+	if bytes > 0 {
+		m.bytes.WithLabelValues(host).Add(float64(bytes))
+	}
+	m.fetchDuration.Observe(d.Seconds())
+}
+
+// Retried records a retry of rawURL.
+func (m *Metrics) Retried(rawURL string) {
+	if m == nil {
+		return
+	}
+	m.retries.WithLabelValues(hostOf(rawURL)).Inc()
+}
+
+// Stored records the time taken to store a response.
+func (m *Metrics) Stored(d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.storeDuration.Observe(d.Seconds())
+}
+
+// Queued adds n, which may be negative, to the queue depth. Queues report
+// changes rather than their length so that several can share the gauge.
+func (m *Metrics) Queued(n int) {
+	if m == nil || n == 0 {
+		return
+	}
+	m.queueDepth.Add(float64(n))
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// StatusClass returns the class of an HTTP status code, e.g. "4xx", or
+// ErrorClass for 0.
+func StatusClass(status int) string {
+	if status < 100 || status > 599 {
+		return ErrorClass
+	}
+	return fmt.Sprintf("%dxx", status/100)
+}
+
+// hostOf returns the lower-cased host of rawURL, without the port.
+func hostOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return "invalid"
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// WriteSummary writes a human-readable summary of the fetch metrics to w.
+func (m *Metrics) WriteSummary(w io.Writer) error {
+	families, err := m.registry.Gather()
+	if err != nil {
+		return err
+	}
+	byName := make(map[string]*dto.MetricFamily, len(families))
+	for _, f := range families {
+		byName[f.GetName()] = f
+	}
+
+	classes := make(map[string]float64)
+	hosts := make(map[string]bool)
+	var fetches float64
+	for _, metric := range byName["urls_fetches_total"].GetMetric() {
+		for _, label := range metric.GetLabel() {
+			switch label.GetName() {
+			case "status_class":
+				classes[label.GetValue()] += metric.GetCounter().GetValue()
+			case "host":
+				hosts[label.GetValue()] = true
+			}
+		}
+		fetches += metric.GetCounter().GetValue()
+	}
+	names := make([]string, 0, len(classes))
+	for class := range classes {
+		names = append(names, class)
+	}
+	sort.Strings(names)
+	parts := make([]string, len(names))
+	for i, class := range names {
+		parts[i] = fmt.Sprintf("%s = %.0f", class, classes[class])
+	}
+
+	fmt.Fprintf(w, "Fetches = %.0f from %d hosts", fetches, len(hosts))
+	if len(parts) > 0 {
+		fmt.Fprintf(w, " (%s)", strings.Join(parts, ", "))
+	}
+	fmt.Fprintf(w, ", Retries = %.0f, Downloaded = %.0f bytes\n",
+		sum(byName["urls_retries_total"]), sum(byName["urls_downloaded_bytes_total"]))
+	fmt.Fprintf(w, "Fetch latency: %s\n", latency(byName["urls_fetch_duration_seconds"]))
+	_, err = fmt.Fprintf(w, "Store latency: %s\n", latency(byName["urls_store_duration_seconds"]))
+	return err
+}
+
+// sum adds up the values of a counter family.
+func sum(family *dto.MetricFamily) float64 {
+	var total float64
+	for _, metric := range family.GetMetric() {
+		total += metric.GetCounter().GetValue()
+	}
+	return total
+}
+
+// latency describes a histogram family by its mean and the bucket bounds of
+// its 50th and 95th percentiles.
+func latency(family *dto.MetricFamily) string {
+	if len(family.GetMetric()) == 0 || family.GetMetric()[0].GetHistogram().GetSampleCount() == 0 {
+		return "no samples"
+	}
+	h := family.GetMetric()[0].GetHistogram()
+	count := float64(h.GetSampleCount())
+	mean := time.Duration(h.GetSampleSum() / count * float64(time.Second))
+	return fmt.Sprintf("mean %v, p50 <= %s, p95 <= %s over %d samples",
+		mean.Round(time.Millisecond), quantile(h, 0.5), quantile(h, 0.95), h.GetSampleCount())
+}
+
+// quantile returns the upper bound of the bucket holding quantile q of h.
+func quantile(h *dto.Histogram, q float64) string {
+	rank := q * float64(h.GetSampleCount())
+	for _, bucket := range h.GetBucket() {
+		if float64(bucket.GetCumulativeCount()) >= rank && !math.IsInf(bucket.GetUpperBound(), 1) {
+			return time.Duration(bucket.GetUpperBound() * float64(time.Second)).String()
+		}
+	}
+	return "+Inf"
+}
@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	m := New()
+	m.Fetched("https://Example.com:8443/a", 200, 1500, 40*time.Millisecond)
+	m.Fetched("https://example.com/b", 404, 10, 80*time.Millisecond)
+	m.Fetched("https://example.org/", 0, 0, 2*time.Second)
+	m.Retried("https://example.org/")
+	m.Stored(3 * time.Millisecond)
+	m.Queued(5)
+	m.Queued(-2)
+
+	w := httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body := w.Body.String()
+	for _, line := range []string{
+		`urls_fetches_total{host="example.com",status_class="2xx"} 1`,
+		`urls_fetches_total{host="example.com",status_class="4xx"} 1`,
+		`urls_fetches_total{host="example.org",status_class="error"} 1`,
+		`urls_downloaded_bytes_total{host="example.com"} 1510`,
+		`urls_retries_total{host="example.org"} 1`,
+		`urls_fetch_duration_seconds_count 3`,
+		`urls_store_duration_seconds_count 1`,
+		`urls_queue_depth 3`,
+	} {
+		assert.Contains(t, body, line)
+	}
+
+	var summary strings.Builder
+	assert.NoError(t, m.WriteSummary(&summary))
+	assert.Equal(t, "Fetches = 3 from 2 hosts (2xx = 1, 4xx = 1, error = 1), Retries = 1, Downloaded = 1510 bytes\n"+
+		"Fetch latency: mean 707ms, p50 <= 100ms, p95 <= 2.5s over 3 samples\n"+
+		"Store latency: mean 3ms, p50 <= 5ms, p95 <= 5ms over 1 samples\n", summary.String())
+
+	// A nil *Metrics records nothing
+	var disabled *Metrics
+	disabled.Fetched("https://example.com/", 200, 1, time.Second)
+	disabled.Queued(1)
+}
+
+func TestStatusClass(t *testing.T) {
+	for status, class := range map[int]string{0: ErrorClass, 101: "1xx", 204: "2xx", 301: "3xx", 429: "4xx", 503: "5xx", 999: ErrorClass} {
+		assert.Equal(t, class, StatusClass(status), status)
+	}
+}
@@ -0,0 +1,53 @@
+package migrate
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestAddContentText runs against the scratch database of TEST_DATABASE_URL,
+// which is dropped.
+func TestAddContentText(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	db, err := sql.Open("postgres", dsn)
+	require.NoError(t, err)
+	defer db.Close()
+	driver, err := postgres.WithInstance(db, &postgres.Config{})
+	require.NoError(t, err)
+	m, err := migrate.NewWithDatabaseInstance("file://../../migrations", "postgres", driver)
+	require.NoError(t, err)
+	require.NoError(t, m.Drop())
+	driver, err = postgres.WithInstance(db, &postgres.Config{})
+	require.NoError(t, err)
+	m, err = migrate.NewWithDatabaseInstance("file://../../migrations", "postgres", driver)
+	require.NoError(t, err)
+
+	require.NoError(t, m.Migrate(5))
+	_, err = db.Exec(`INSERT INTO url_contents (hash, size, data) VALUES ('latin1', 4, '\xe9t\xe9s'::bytea), ('png', 4, '\x89504e47'::bytea)`)
+	require.NoError(t, err)
+
+	// Bodies that are not UTF-8 do not break the migration, nor get a charset
+	require.NoError(t, m.Migrate(6))
+	rows, err := db.Query(`SELECT hash FROM url_contents WHERE charset IS NULL AND text IS NULL ORDER BY hash`)
+	require.NoError(t, err)
+	defer rows.Close()
+	var hashes []string
+	for rows.Next() {
+		var hash string
+		require.NoError(t, rows.Scan(&hash))
+		hashes = append(hashes, hash)
+	}
+	require.NoError(t, rows.Err())
+	assert.Equal(t, []string{"latin1", "png"}, hashes)
+
+	require.NoError(t, m.Up())
+}
@@ -0,0 +1,335 @@
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"url.com/data/internal/crawler"
+)
+
+// Format is the format a report is written in.
+type Format string
+
+const (
+	Auto  Format = "auto"
+	JSON  Format = "json"
+	CSV   Format = "csv"
+	JUnit Format = "junit"
+)
+
+// ParseFormat validates a format name given on the command line.
+func ParseFormat(name string) (Format, error) {
+	switch f := Format(strings.ToLower(name)); f {
+	case "", Auto:
+		return Auto, nil
+	case JSON, CSV, JUnit:
+		return f, nil
+	case "xml":
+		return JUnit, nil
+	}
+	return "", fmt.Errorf("unknown report format %q", name)
+}
+
+// DetectFormat picks the format of path from its extension, defaulting to
+// JSON.
+func DetectFormat(path string) Format {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return CSV
+	case ".xml":
+		return JUnit
+	}
+	return JSON
+}
+
+// Outcome classifies a crawled URL.
+type Outcome string
+
+const (
+	OK        Outcome = "ok"
+	Skipped   Outcome = "skipped"
+	Transient Outcome = "transient"
+	Failed    Outcome = "failed"
+)
+
+// Entry is the report line of a single URL.
+type Entry struct {
+	URL        string  `json:"url"`
+	Outcome    Outcome `json:"outcome"`
+	StatusCode int     `json:"status_code,omitempty"`
+	Bytes      int64   `json:"bytes"`
+	DurationMs int64   `json:"duration_ms"`
+	Attempts   int     `json:"attempts,omitempty"`
+	Error      string  `json:"error,omitempty"`
+	// FinalURL is the URL that answered after following redirects, and
+	// CertExpires when the first certificate of its server's chain expires,
+	// for HTTPS URLs.
+	FinalURL    string    `json:"final_url,omitempty"`
+	CertExpires time.Time `json:"cert_expires,omitzero"`
+}
+
+// FromResult turns a crawl result into a report entry.
+func FromResult(result crawler.Result) Entry {
+	e := Entry{
+		URL:         result.URL,
+		Outcome:     OK,
+		StatusCode:  result.StatusCode,
+		Bytes:       result.Bytes,
+		DurationMs:  result.Duration.Milliseconds(),
+		Attempts:    result.Attempts,
+		FinalURL:    result.FinalURL,
+		CertExpires: result.CertNotAfter,
+	}
+	if result.Err != nil {
+		e.Error = result.Err.Error()
+		switch crawler.KindOf(result.Err) {
+		case crawler.Policy:
+			e.Outcome = Skipped
+		case crawler.Transient:
+			e.Outcome = Transient
+		default:
+			e.Outcome = Failed
+		}
+	}
+	return e
+}
+
+// Summary counts the entries of a report by outcome.
+type Summary struct {
+	Total     int `json:"total"`
+	OK        int `json:"ok"`
+	Skipped   int `json:"skipped"`
+	Transient int `json:"transient"`
+	Failed    int `json:"failed"`
+	// Invalid counts input lines that were not valid URLs and never crawled.
+	Invalid int `json:"invalid"`
+}
+
+// Add counts e in the summary.
+func (s *Summary) Add(e Entry) {
+	s.Total++
+	switch e.Outcome {
+	case OK:
+		s.OK++
+	case Skipped:
+		s.Skipped++
+	case Transient:
+		s.Transient++
+	default:
+		s.Failed++
+	}
+}
+
+// Failures is the number of URLs that could not be fetched, transient
+// failures included.
+func (s Summary) Failures() int {
+	return s.Transient + s.Failed
+}
+
+// Report is the outcome of a crawl run.
+type Report struct {
+	Started  time.Time `json:"started"`
+	Duration float64   `json:"duration_seconds"`
+	Summary  Summary   `json:"summary"`
+	Entries  []Entry   `json:"results"`
+}
+
+// Add records result in the report.
+func (r *Report) Add(result crawler.Result) Entry {
+	e := FromResult(result)
+	r.Entries = append(r.Entries, e)
+	r.Summary.Add(e)
+	return e
+}
+
+// CertExpiry is when the certificate chain of a host expires.
+type CertExpiry struct {
+	Host     string
+	NotAfter time.Time
+}
+
+// ExpiringCerts returns the hosts whose certificates expire before deadline,
+// soonest first. The certificate is the one of the host that answered, after
+// redirects.
+func (r *Report) ExpiringCerts(deadline time.Time) []CertExpiry {
+	earliest := make(map[string]time.Time)
+	for _, e := range r.Entries {
+		if e.CertExpires.IsZero() || !e.CertExpires.Before(deadline) {
+			continue
+		}
+		answered := e.FinalURL
+		if answered == "" {
+			answered = e.URL
+		}
+		host := answered
+		if u, err := url.Parse(answered); err == nil && u.Host != "" {
+			host = strings.ToLower(u.Host)
+		}
+		if notAfter, ok := earliest[host]; !ok || e.CertExpires.Before(notAfter) {
+			earliest[host] = e.CertExpires
+		}
+	}
+
+	expiring := make([]CertExpiry, 0, len(earliest))
+	for host, notAfter := range earliest {
+		expiring = append(expiring, CertExpiry{Host: host, NotAfter: notAfter})
+	}
+	sort.Slice(expiring, func(i, j int) bool {
+		if !expiring[i].NotAfter.Equal(expiring[j].NotAfter) {
+			return expiring[i].NotAfter.Before(expiring[j].NotAfter)
+		}
+		return expiring[i].Host < expiring[j].Host
+	})
+	return expiring
+}
+
+// WriteFile writes the report to path, or to stdout when path is "-".
+func (r *Report) WriteFile(path string, format Format) error {
+	if format == Auto {
+		format = DetectFormat(path)
+	}
+	if path == "-" {
+		return r.Write(os.Stdout, format)
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := r.Write(file, format); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Write writes the report to w in the given format.
+func (r *Report) Write(w io.Writer, format Format) error {
+	switch format {
+	case JSON, Auto:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r)
+	case CSV:
+		return r.writeCSV(w)
+	case JUnit:
+		return r.writeJUnit(w)
+	}
+	return fmt.Errorf("unknown report format %q", format)
+}
+
+func (r *Report) writeCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"url", "outcome", "status_code", "bytes", "duration_ms", "attempts", "error", "cert_expires", "final_url"}); err != nil {
+		return err
+	}
+	for _, e := range r.Entries {
+		var certExpires string
+		if !e.CertExpires.IsZero() {
+			certExpires = e.CertExpires.Format(time.RFC3339)
+		}
+		record := []string{
+			e.URL, string(e.Outcome), strconv.Itoa(e.StatusCode), strconv.FormatInt(e.Bytes, 10),
+			strconv.FormatInt(e.DurationMs, 10), strconv.Itoa(e.Attempts), e.Error, certExpires, e.FinalURL,
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// JUnit XML as understood by CI systems: one test case per URL, grouped by
+// host in the class name. Permanent failures are failures, transient ones
+// errors, and policy skips skipped tests.
+type junitSuites struct {
+	XMLName xml.Name     `xml:"testsuites"`
+	Suites  []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name      string      `xml:"name,attr"`
+	Tests     int         `xml:"tests,attr"`
+	Failures  int         `xml:"failures,attr"`
+	Errors    int         `xml:"errors,attr"`
+	Skipped   int         `xml:"skipped,attr"`
+	Time      string      `xml:"time,attr"`
+	Timestamp string      `xml:"timestamp,attr,omitempty"`
+	Cases     []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr,omitempty"`
+}
+
+func (r *Report) writeJUnit(w io.Writer) error {
+	suite := junitSuite{
+		Name:     "urls",
+		Tests:    r.Summary.Total,
+		Failures: r.Summary.Failed,
+		Errors:   r.Summary.Transient,
+		Skipped:  r.Summary.Skipped,
+		Time:     strconv.FormatFloat(r.Duration, 'f', 3, 64),
+	}
+	if !r.Started.IsZero() {
+		suite.Timestamp = r.Started.UTC().Format("2006-01-02T15:04:05")
+	}
+	for _, e := range r.Entries {
+		c := junitCase{
+			Name:      e.URL,
+			ClassName: classNameOf(e.URL),
+			Time:      strconv.FormatFloat(float64(e.DurationMs)/1000, 'f', 3, 64),
+		}
+		message := &junitMessage{Message: e.Error, Type: string(e.Outcome)}
+		switch e.Outcome {
+		case Failed:
+			c.Failure = message
+		case Transient:
+			c.Error = message
+		case Skipped:
+			c.Skipped = message
+		}
+		suite.Cases = append(suite.Cases, c)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(junitSuites{Suites: []junitSuite{suite}}); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// classNameOf groups test cases by host.
+func classNameOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return "urls"
+	}
+	return strings.ToLower(u.Host)
+}
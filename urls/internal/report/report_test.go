@@ -0,0 +1,134 @@
+package report
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"url.com/data/internal/crawler"
+)
+
+func testReport() *Report {
+	r := &Report{Duration: 1.5}
+	r.Add(crawler.Result{URL: "https://example.com/", StatusCode: 200, Bytes: 512, Duration: 120 * time.Millisecond, Attempts: 1,
+		FinalURL: "https://www.example.com/", CertNotAfter: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)})
+	r.Add(crawler.Result{URL: "https://example.com/missing", StatusCode: 404, Attempts: 1,
+		Err: &crawler.FetchError{URL: "https://example.com/missing", Kind: crawler.Permanent, StatusCode: 404, Attempts: 1, Err: errors.New("unexpected status 404 Not Found")}})
+	r.Add(crawler.Result{URL: "https://example.org/slow", StatusCode: 503, Attempts: 4,
+		Err: &crawler.FetchError{URL: "https://example.org/slow", Kind: crawler.Transient, StatusCode: 503, Attempts: 4, Err: errors.New("unexpected status 503")}})
+	r.Add(crawler.Result{URL: "https://example.org/admin",
+		Err: &crawler.FetchError{URL: "https://example.org/admin", Kind: crawler.Policy, Err: crawler.ErrDisallowed}})
+	return r
+}
+
+func TestSummary(t *testing.T) {
+	r := testReport()
+
+	assert.Equal(t, Summary{Total: 4, OK: 1, Skipped: 1, Transient: 1, Failed: 1}, r.Summary)
+	assert.Equal(t, 2, r.Summary.Failures())
+}
+
+func TestBrokenLinksFail(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder("GET", "https://example.com/", httpmock.NewStringResponder(200, "ok"))
+	httpmock.RegisterResponder("GET", "https://example.com/gone", httpmock.NewStringResponder(410, "gone"))
+	httpmock.RegisterResponder("GET", "https://example.com/missing", httpmock.NewStringResponder(404, "not found"))
+
+	store, err := crawler.OpenSQLiteStore(filepath.Join(t.TempDir(), "urls.db"), crawler.NoCompression)
+	require.NoError(t, err)
+	defer store.Close()
+	c := crawler.New(store, crawler.Options{IgnoreRobots: true})
+
+	// Stored, but counted against --max-failures and reported as failures
+	r := &Report{}
+	for _, url := range []string{"https://example.com/", "https://example.com/gone", "https://example.com/missing"} {
+		r.Add(c.Visit(context.Background(), url))
+	}
+	assert.Equal(t, Summary{Total: 3, OK: 1, Failed: 2}, r.Summary)
+	assert.Equal(t, 410, r.Entries[1].StatusCode)
+
+	var junit bytes.Buffer
+	require.NoError(t, r.Write(&junit, JUnit))
+	assert.Contains(t, junit.String(), `failures="2"`)
+}
+
+func TestWrite(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   Format
+		contains []string
+	}{
+		{
+			name:   "JSON",
+			format: JSON,
+			contains: []string{
+				`"url": "https://example.com/missing"`,
+				`"outcome": "failed"`,
+				`"final_url": "https://www.example.com/"`,
+				`"cert_expires": "2024-06-01T00:00:00Z"`,
+				`"total": 4`,
+			},
+		},
+		{
+			name:   "CSV",
+			format: CSV,
+			contains: []string{
+				"url,outcome,status_code,bytes,duration_ms,attempts,error,cert_expires,final_url\n",
+				"https://example.com/,ok,200,512,120,1,,2024-06-01T00:00:00Z,https://www.example.com/\n",
+				"https://example.org/slow,transient,503,0,0,4,",
+			},
+		},
+		{
+			name:   "JUnit",
+			format: JUnit,
+			contains: []string{
+				`<testsuite name="urls" tests="4" failures="1" errors="1" skipped="1" time="1.500">`,
+				`<testcase name="https://example.com/" classname="example.com" time="0.120"></testcase>`,
+				`<failure message="permanent failure fetching https://example.com/missing`,
+				`<skipped message=`,
+			},
+		},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			assert.NoError(t, testReport().Write(&buf, testCase.format))
+			for _, s := range testCase.contains {
+				assert.True(t, strings.Contains(buf.String(), s), "missing %q in\n%s", s, buf.String())
+			}
+		})
+	}
+}
+
+func TestExpiringCerts(t *testing.T) {
+	soon := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	r := &Report{}
+	r.Add(crawler.Result{URL: "https://example.com/a", CertNotAfter: soon.Add(time.Hour)})
+	r.Add(crawler.Result{URL: "https://Example.com/b", CertNotAfter: soon})
+	r.Add(crawler.Result{URL: "https://example.org:8443/", CertNotAfter: soon.Add(-time.Hour)})
+	r.Add(crawler.Result{URL: "https://example.net/", CertNotAfter: soon.AddDate(1, 0, 0)})
+	r.Add(crawler.Result{URL: "http://example.com/plain"})
+	// Keyed on the host that answered after redirects
+	r.Add(crawler.Result{URL: "http://example.net/moved", FinalURL: "https://shop.example.net/", CertNotAfter: soon.Add(2 * time.Hour)})
+
+	assert.Equal(t, []CertExpiry{
+		{Host: "example.org:8443", NotAfter: soon.Add(-time.Hour)},
+		{Host: "example.com", NotAfter: soon},
+		{Host: "shop.example.net", NotAfter: soon.Add(2 * time.Hour)},
+	}, r.ExpiringCerts(soon.AddDate(0, 1, 0)))
+}
+
+func TestDetectFormat(t *testing.T) {
+	assert.Equal(t, CSV, DetectFormat("report.csv"))
+	assert.Equal(t, JUnit, DetectFormat("junit.xml"))
+	assert.Equal(t, JSON, DetectFormat("report"))
+}
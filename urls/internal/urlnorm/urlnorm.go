@@ -0,0 +1,156 @@
+// Package urlnorm rewrites URLs into a canonical form so that the spellings
+// of a page are fetched and stored once.
+package urlnorm
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// DefaultStripParams are the tracking parameters removed by default.
+var DefaultStripParams = []string{
+	"utm_*", "gclid", "dclid", "gbraid", "wbraid", "fbclid", "msclkid", "yclid", "twclid", "igshid",
+	"mc_cid", "mc_eid", "_ga", "_gl", "_hsenc", "_hsmi", "mkt_tok",
+}
+
+// Options controls the rewrites beyond the ones always made.
+type Options struct {
+	// StripParams are the query parameters removed, matched without regard
+	// to case. A trailing * matches any suffix, e.g. "utm_*".
+	StripParams []string
+	// SortQuery orders the remaining query parameters by name, keeping the
+	// order of repeated ones.
+	SortQuery bool
+}
+
+// Normalizer canonicalizes URLs.
+type Normalizer struct {
+	exact    map[string]bool
+	prefixes []string
+	sort     bool
+}
+
+// New returns a Normalizer applying opts.
+func New(opts Options) *Normalizer {
+	n := &Normalizer{exact: make(map[string]bool), sort: opts.SortQuery}
+	for _, p := range opts.StripParams {
+		p = strings.ToLower(strings.TrimSpace(p))
+		switch {
+		case p == "":
+		case strings.HasSuffix(p, "*"):
+			n.prefixes = append(n.prefixes, strings.TrimSuffix(p, "*"))
+		default:
+			n.exact[p] = true
+		}
+	}
+	return n
+}
+
+// Normalize returns the canonical form of raw: surrounding blanks trimmed,
+// scheme and host lower-cased, default ports, empty paths and fragments
+// dropped, and the query rewritten according to the options.
+func (n *Normalizer) Normalize(raw string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return "", err
+	}
+	if !u.IsAbs() || u.Host == "" {
+		return "", fmt.Errorf("invalid URL %q: not absolute", raw)
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	host, port := strings.ToLower(u.Hostname()), u.Port()
+	host = strings.TrimSuffix(host, ".")
+	if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	if strings.Contains(host, ":") {
+		// IPv6 literal
+		host = "[" + host + "]"
+	}
+	if port != "" {
+		host += ":" + port
+	}
+	u.Host = host
+
+	if u.Path == "" {
+		u.Path, u.RawPath = "/", ""
+	}
+	u.Fragment, u.RawFragment = "", ""
+	u.RawQuery = n.query(u.RawQuery)
+	u.ForceQuery = false
+	return u.String(), nil
+}
+
+// query strips and sorts the parameters of rawQuery. Parameters are kept as
+// they were escaped to avoid changing their meaning.
+func (n *Normalizer) query(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+
+	type param struct{ key, raw string }
+	var params []param
+	for _, raw := range strings.Split(rawQuery, "&") {
+		if raw == "" {
+			continue
+		}
+		key, _, _ := strings.Cut(raw, "=")
+		if unescaped, err := url.QueryUnescape(key); err == nil {
+			key = unescaped
+		}
+		if n.strip(key) {
+			continue
+		}
+		params = append(params, param{key: key, raw: raw})
+	}
+	if n.sort {
+		sort.SliceStable(params, func(i, j int) bool { return params[i].key < params[j].key })
+	}
+
+	parts := make([]string, len(params))
+	for i, p := range params {
+		parts[i] = p.raw
+	}
+	return strings.Join(parts, "&")
+}
+
+func (n *Normalizer) strip(key string) bool {
+	key = strings.ToLower(key)
+	if n.exact[key] {
+		return true
+	}
+	for _, prefix := range n.prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Seen is a set of canonical URLs.
+type Seen struct {
+	n    *Normalizer
+	urls map[string]bool
+}
+
+// NewSeen returns an empty set canonicalizing with n.
+func NewSeen(n *Normalizer) *Seen {
+	return &Seen{n: n, urls: make(map[string]bool)}
+}
+
+// Add canonicalizes raw and adds it to the set. It returns the canonical URL
+// and whether it was new.
+func (s *Seen) Add(raw string) (string, bool, error) {
+	canonical, err := s.n.Normalize(raw)
+	if err != nil {
+		return "", false, err
+	}
+	if s.urls[canonical] {
+		return canonical, false, nil
+	}
+	s.urls[canonical] = true
+	return canonical, true, nil
+}
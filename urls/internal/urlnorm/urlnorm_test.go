@@ -0,0 +1,54 @@
+package urlnorm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalize(t *testing.T) {
+	n := New(Options{StripParams: DefaultStripParams, SortQuery: true})
+
+	tests := []struct {
+		raw      string
+		expected string
+	}{
+		{"HTTP://Example.com/a#x", "http://example.com/a"},
+		{" http://example.com/a ", "http://example.com/a"},
+		{"https://example.com:443", "https://example.com/"},
+		{"http://example.com:8080/a", "http://example.com:8080/a"},
+		{"https://example.com./a?", "https://example.com/a"},
+		{"https://example.com/A/b%2Fc", "https://example.com/A/b%2Fc"},
+		{"https://example.com/?utm_source=x&b=2&a=1&UTM_Medium=y&gclid=z", "https://example.com/?a=1&b=2"},
+		{"https://example.com/?b=2&a=3&a=1", "https://example.com/?a=3&a=1&b=2"},
+		{"https://example.com/?q=a%20b&q2=a+b", "https://example.com/?q=a%20b&q2=a+b"},
+		{"http://[::1]:80/x", "http://[::1]/x"},
+	}
+	for _, testCase := range tests {
+		got, err := n.Normalize(testCase.raw)
+		assert.NoError(t, err, testCase.raw)
+		assert.Equal(t, testCase.expected, got, testCase.raw)
+	}
+
+	_, err := n.Normalize("/relative")
+	assert.Error(t, err)
+
+	// Without options the query is left alone
+	got, err := New(Options{}).Normalize("https://example.com/?utm_source=x&b=2&a=1")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://example.com/?utm_source=x&b=2&a=1", got)
+}
+
+func TestSeen(t *testing.T) {
+	seen := NewSeen(New(Options{StripParams: DefaultStripParams}))
+
+	var added []string
+	for _, raw := range []string{"HTTP://Example.com/a#x", "http://example.com/a", " http://example.com/a", "http://example.com/a?utm_campaign=z", "http://example.com/b"} {
+		canonical, isNew, err := seen.Add(raw)
+		assert.NoError(t, err)
+		if isNew {
+			added = append(added, canonical)
+		}
+	}
+	assert.Equal(t, []string{"http://example.com/a", "http://example.com/b"}, added)
+}
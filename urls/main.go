@@ -1,18 +1,469 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 
+	"url.com/data/internal/api"
+	"url.com/data/internal/change"
 	"url.com/data/internal/config"
 	"url.com/data/internal/crawler"
+	"url.com/data/internal/extract"
+	"url.com/data/internal/input"
+	"url.com/data/internal/metrics"
 	"url.com/data/internal/migrate"
+	"url.com/data/internal/report"
+	"url.com/data/internal/urlnorm"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "diff" {
+		diffCommand(os.Args[2:])
+		return
+	}
+
+	urlsFlag := flag.String("urls", "", "Comma-separated list of URLs to fetch")
+	inputFlag := flag.String("input", "", "File with URLs to fetch, or - for stdin")
+	inputFormat := flag.String("input-format", "auto", "Format of --input: auto, text, csv or jsonl")
+	workers := flag.Int("workers", 10, "Number of URLs fetched concurrently")
+	perHost := flag.Int("per-host", 2, "Maximum concurrent requests per host (0 for no limit)")
+	crawl := flag.Bool("crawl", false, "Follow links found in fetched HTML pages")
+	maxDepth := flag.Int("max-depth", 2, "Maximum link depth from the seed URLs in crawl mode")
+	maxPages := flag.Int("max-pages", 100, "Maximum number of pages fetched in crawl mode (0 for no limit)")
+	allowedDomains := flag.String("allowed-domains", "", "Comma-separated domains followed in crawl mode besides the seed hosts")
+	userAgent := flag.String("user-agent", crawler.DefaultUserAgent, "User agent sent with requests and matched against robots.txt")
+	ignoreRobots := flag.Bool("ignore-robots", false, "Do not fetch or obey robots.txt")
+	retries := flag.Int("retries", crawler.DefaultRetryPolicy.MaxRetries, "Number of retries for transient failures")
+	retryDelay := flag.Duration("retry-delay", crawler.DefaultRetryPolicy.BaseDelay, "Initial backoff between retries")
+	maxRetryDelay := flag.Duration("max-retry-delay", crawler.DefaultRetryPolicy.MaxDelay, "Maximum backoff between retries")
+	failOnStatus := flag.Bool("fail-on-status", false, "Do not store non-2xx responses; they count as failures either way")
+	conditional := flag.Bool("conditional", true, "Revalidate previously stored URLs with ETag/Last-Modified")
+	compression := flag.String("compress", "none", "Compression of stored bodies: none, gzip or zstd")
+	maxBodySize := flag.Int64("max-body-size", 50<<20, "Maximum response body size in bytes (0 for no limit)")
+	truncateBody := flag.Bool("truncate-body", false, "Truncate bodies over --max-body-size instead of rejecting them")
+	timeout := flag.Duration("timeout", 0, "Stop starting new URLs after this long (0 for no limit)")
+	gracePeriod := flag.Duration("grace-period", 10*time.Second, "How long in-flight URLs may finish after a signal or --timeout")
+	storeFlag := flag.String("store", "postgres", "Where results are stored: postgres, sqlite or file")
+	storePath := flag.String("store-path", "", "SQLite database file or directory of the file store (default urls.db or urls-data)")
+	reportPath := flag.String("report", "", "Write a per-URL report to this file, or - for stdout")
+	reportFormat := flag.String("report-format", "auto", "Format of --report: auto, json, csv or junit")
+	maxFailures := flag.Int("max-failures", -1, "Exit with status 1 when more URLs than this fail, non-2xx responses included (-1 to never fail)")
+	persist := flag.Bool("persist", false, "Store the queue as a crawl job in Postgres so that it can be resumed")
+	resume := flag.Int64("resume", 0, "Resume the crawl job with this ID, or join it from another process, skipping URLs it already finished")
+	workerID := flag.String("worker-id", defaultWorkerID(), "Name of this process in the leases it takes on job URLs")
+	lease := flag.Duration("lease", crawler.DefaultLease, "How long job URLs claimed by a process that stopped sending heartbeats stay claimed")
+	watch := flag.Bool("watch", false, "Keep running and fetch every URL again whenever its schedule is due")
+	interval := flag.String("interval", "1h", "Schedule of URLs without one in watch mode: an interval such as 15m or a cron expression")
+	webhook := flag.String("webhook", "", "URL notified with a JSON POST when a watched page changes")
+	changeSelector := flag.String("change-selector", "", "CSS selector of the part of watched pages compared for changes (default the whole page)")
+	changeIgnore := flag.String("change-ignore", "", "Comma-separated regular expressions removed from watched pages before comparing, e.g. timestamps")
+	changeThreshold := flag.Float64("change-threshold", 0, "Share of lines, from 0 to 1, that must change before a watched page counts as changed")
+	contentTypes := flag.String("content-types", "", "Comma-separated media types to store, e.g. text/html,application/json (empty for all)")
+	sitemapFlag := flag.String("sitemap", "", "Comma-separated sites (e.g. example.com) or sitemap URLs whose pages are fetched too")
+	sitemapLastMod := flag.Bool("sitemap-lastmod", true, "Skip sitemap pages whose lastmod is not after the last time they were stored")
+	stripParams := flag.String("strip-params", strings.Join(urlnorm.DefaultStripParams, ","), "Comma-separated query parameters removed from URLs, * matching any suffix (empty to keep all)")
+	sortQuery := flag.Bool("sort-query", true, "Sort query parameters so that URLs differing only in their order are fetched once")
+	rulesPath := flag.String("rules", "", "JSON file of rules extracting named fields from the pages whose URL they match")
+	serve := flag.String("serve", "", "Serve an HTTP API for submitting crawl jobs on this address, e.g. 127.0.0.1:8080, instead of fetching URLs given on the command line. Jobs fetch any URL they are given: keep the address internal and set API_TOKEN to require it as a bearer token")
+	requestTimeout := flag.Duration("request-timeout", crawler.DefaultTimeout, "Timeout of a single request, including reading its body")
+	var headers http.Header
+	flag.Func("header", "Header sent with every request, as \"Name: value\" (repeatable)", func(v string) error {
+		name, value, ok := strings.Cut(v, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			return fmt.Errorf("expected \"Name: value\", got %q", v)
+		}
+		if http.CanonicalHeaderKey(strings.TrimSpace(name)) == "User-Agent" {
+			return errors.New("set the User-Agent with --user-agent")
+		}
+		if headers == nil {
+			headers = make(http.Header)
+		}
+		headers.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+		return nil
+	})
+	proxy := flag.String("proxy", "", "Proxy requests go through, e.g. http://proxy:3128 or socks5://proxy:1080 (default from HTTP_PROXY/HTTPS_PROXY)")
+	cookies := flag.Bool("cookies", false, "Keep cookies set by servers for the rest of the run or job. They are kept in memory only: a job resumed with --resume, or run by several processes, does not share them")
+	authPath := flag.String("auth", "", "JSON file of per-host credentials: basic auth, bearer tokens or custom headers")
+	caCerts := flag.String("ca-cert", "", "Comma-separated PEM files of root CAs trusted besides the system ones")
+	var clientCerts []crawler.ClientCert
+	flag.Func("client-cert", "Client certificate presented to a host, as host=cert.pem,key.pem (repeatable, *.example.com matches subdomains)", func(v string) error {
+		cert, err := crawler.ParseClientCert(v)
+		if err != nil {
+			return err
+		}
+		clientCerts = append(clientCerts, cert)
+		return nil
+	})
+	tlsMinVersion := flag.String("tls-min-version", "", "Lowest TLS version accepted: 1.0, 1.1, 1.2 or 1.3 (default Go's)")
+	certExpiry := flag.Duration("cert-expiry", 30*24*time.Hour, "Warn about server certificates expiring within this long (0 to never warn)")
+	metricsAddr := flag.String("metrics-addr", "", "Serve Prometheus metrics on /metrics at this address, e.g. :9090 (with --serve they are also on the API address)")
+	flag.Parse()
+	if *urlsFlag == "" && *inputFlag == "" && *sitemapFlag == "" && *resume == 0 && *serve == "" {
+		fmt.Println("Please provide URLs with the --urls, --input or --sitemap flag, a job with --resume, or an address with --serve.")
+		return
+	}
+
+	storeCompression, err := crawler.ParseCompression(*compression)
+	if err != nil {
+		log.Fatalf("invalid --compress: %v", err)
+	}
+	storeKind, err := crawler.ParseStoreKind(*storeFlag)
+	if err != nil {
+		log.Fatalf("invalid --store: %v", err)
+	}
+	format, err := report.ParseFormat(*reportFormat)
+	if err != nil {
+		log.Fatalf("invalid --report-format: %v", err)
+	}
+	if (*persist || *resume != 0) && storeKind != crawler.PostgresStoreKind {
+		log.Fatalf("--persist and --resume need --store %s", crawler.PostgresStoreKind)
+	}
+	if *watch && (*crawl || *persist || *resume != 0) {
+		log.Fatalf("--watch cannot be combined with --crawl, --persist or --resume")
+	}
+	if *serve != "" && storeKind != crawler.PostgresStoreKind {
+		log.Fatalf("--serve needs --store %s", crawler.PostgresStoreKind)
+	}
+	if *serve != "" && (*watch || *persist || *resume != 0 || *urlsFlag != "" || *inputFlag != "" || *sitemapFlag != "") {
+		log.Fatalf("--serve cannot be combined with --watch, --persist, --resume or URLs to fetch")
+	}
+	if *sitemapFlag != "" && (*watch || *resume != 0) {
+		log.Fatalf("--sitemap cannot be combined with --watch or --resume")
+	}
+	ignore, err := change.ParseIgnore(strings.Split(*changeIgnore, ","))
+	if err != nil {
+		log.Fatalf("invalid --change-ignore: %v", err)
+	}
+
+	clientOpts := crawler.ClientOptions{Timeout: *requestTimeout, Headers: headers, Cookies: *cookies}
+	if *proxy != "" {
+		if clientOpts.Proxy, err = crawler.ParseProxy(*proxy); err != nil {
+			log.Fatalf("invalid --proxy: %v", err)
+		}
+	}
+	clientOpts.TLS.ClientCerts = clientCerts
+	if clientOpts.TLS.MinVersion, err = crawler.ParseTLSVersion(*tlsMinVersion); err != nil {
+		log.Fatalf("invalid --tls-min-version: %v", err)
+	}
+	if *caCerts != "" {
+		if clientOpts.TLS.RootCAs, err = crawler.LoadRootCAs(strings.Split(*caCerts, ",")); err != nil {
+			log.Fatalf("invalid --ca-cert: %v", err)
+		}
+	}
+	if *authPath != "" {
+		if clientOpts.Auth, err = crawler.LoadAuth(*authPath); err != nil {
+			log.Fatalf("invalid --auth: %v", err)
+		}
+	}
+
+	var rules *extract.Rules
+	if *rulesPath != "" {
+		if rules, err = extract.Load(*rulesPath); err != nil {
+			log.Fatalf("invalid --rules: %v", err)
+		}
+	}
+
+	entries, invalidCount, err := loadEntries(*urlsFlag, *inputFlag, *inputFormat)
+	if err != nil {
+		log.Fatalf("failed to read URLs: %v", err)
+	}
+	normalizer := urlnorm.New(urlnorm.Options{StripParams: strings.Split(*stripParams, ","), SortQuery: *sortQuery})
+	seen := urlnorm.NewSeen(normalizer)
+	entries = canonicalEntries(entries, seen)
+	urls := input.URLs(entries)
+
+	var targets []crawler.Target
+	if *watch {
+		targets, err = watchTargets(entries, *interval)
+		if err != nil {
+			log.Fatalf("invalid --interval: %v", err)
+		}
+		invalidCount += len(entries) - len(targets)
+	}
+
+	store, err := openStore(storeKind, *storePath, storeCompression, *workers)
+	if err != nil {
+		log.Fatalf("failed to open %s store: %v", storeKind, err)
+	}
+	defer store.Close()
+
+	opts := crawler.Options{
+		UserAgent:    *userAgent,
+		IgnoreRobots: *ignoreRobots,
+		Client:       clientOpts,
+		Retry:        crawler.RetryPolicy{MaxRetries: *retries, BaseDelay: *retryDelay, MaxDelay: *maxRetryDelay},
+		FailOnStatus: *failOnStatus,
+		Conditional:  *conditional,
+		MaxBodySize:  *maxBodySize,
+		TruncateBody: *truncateBody,
+		Rules:        rules,
+		Normalizer:   normalizer,
+		Metrics:      metrics.New(),
+	}
+	if *contentTypes != "" {
+		opts.ContentTypes = strings.Split(*contentTypes, ",")
+	}
+	ctx := context.Background()
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+
+	// Stop dispatching on the first signal; a second one kills the process
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+		log.Printf("Stopping: %v, waiting up to %v for in-flight URLs", context.Cause(ctx), *gracePeriod)
+	}()
+
+	started := time.Now()
+	c := crawler.New(store, opts)
+	pool := crawler.NewPool(*workers, *perHost)
+	pool.SetGracePeriod(*gracePeriod)
+	pool.SetMetrics(opts.Metrics)
+	if *metricsAddr != "" {
+		go serveMetrics(*metricsAddr, opts.Metrics)
+	}
+	if *sitemapFlag != "" {
+		pages, err := sitemapURLs(ctx, c, strings.Split(*sitemapFlag, ","), seen, *sitemapLastMod)
+		if err != nil {
+			log.Print(err)
+			store.Close()
+			os.Exit(1)
+		}
+		urls = append(urls, pages...)
+	}
+	crawlOpts := crawler.CrawlOptions{MaxDepth: *maxDepth, MaxPages: *maxPages}
+	if *allowedDomains != "" {
+		crawlOpts.AllowedDomains = strings.Split(*allowedDomains, ",")
+	}
+	if *serve != "" {
+		sqlStore := store.(*crawler.SQLStore)
+		frontier := crawler.NewFrontier(sqlStore.DB(), *workerID, *lease)
+		server := api.New(ctx, sqlStore, frontier, c, pool, normalizer, crawlOpts)
+		server.SetMetrics(opts.Metrics)
+		if token := config.GetEnvWithDefault("API_TOKEN", ""); token != "" {
+			server.SetToken(token)
+		} else {
+			log.Printf("API_TOKEN is not set: anyone who can reach %s can submit jobs and read stored responses", *serve)
+		}
+		if err := server.ListenAndServe(*serve); err != nil {
+			log.Printf("failed to serve the API on %s: %v", *serve, err)
+			store.Close()
+			os.Exit(1)
+		}
+		return
+	}
+
+	var results <-chan crawler.Result
+	switch {
+	case *persist || *resume != 0:
+		frontier := crawler.NewFrontier(store.(*crawler.SQLStore).DB(), *workerID, *lease)
+		var job *crawler.Job
+		if *resume != 0 {
+			// The job keeps the crawl settings it was created with
+			job, err = frontier.LoadJob(ctx, *resume)
+		} else {
+			job, err = frontier.CreateJob(ctx, *crawl, crawlOpts, urls)
+		}
+		if err != nil {
+			log.Printf("failed to start job: %v", err)
+			store.Close()
+			os.Exit(1)
+		}
+		log.Printf("Running job %d", job.ID)
+		if results, err = pool.RunJob(ctx, c, frontier, job); err != nil {
+			log.Printf("failed to run job %d: %v", job.ID, err)
+			store.Close()
+			os.Exit(1)
+		}
+	case *watch:
+		log.Printf("Watching %d URLs", len(targets))
+		monitor := change.NewMonitor(store, change.Options{Selector: *changeSelector, Ignore: ignore}, *changeThreshold, *webhook)
+		results = pool.Watch(ctx, targets, monitor.Wrap(c.Visit))
+	case *crawl:
+		results = pool.Crawl(ctx, c, urls, crawlOpts)
+	default:
+		results = pool.Fetch(ctx, c, urls)
+	}
+
+	run := &report.Report{Started: started, Summary: report.Summary{Invalid: invalidCount}}
+	for result := range results {
+		entry := run.Add(result)
+		if entry.Outcome == report.Transient || entry.Outcome == report.Failed {
+			log.Printf("Error URL: %v\n", result.Err)
+		}
+	}
+	run.Duration = time.Since(started).Seconds()
+
+	summary := run.Summary
+	fmt.Printf("Success count = %d, Skipped count = %d, Transient failures = %d, Failurecount = %d, Invalid count = %d",
+		summary.OK, summary.Skipped, summary.Transient, summary.Failed, summary.Invalid)
+	if !*crawl && !*watch && summary.Total < len(urls) {
+		fmt.Printf(", Not started = %d", len(urls)-summary.Total)
+	}
+	fmt.Println()
+	if !*watch {
+		if err := opts.Metrics.WriteSummary(os.Stdout); err != nil {
+			log.Printf("failed to summarize metrics: %v", err)
+		}
+	}
+	if *certExpiry > 0 {
+		for _, cert := range run.ExpiringCerts(time.Now().Add(*certExpiry)) {
+			log.Printf("certificate of %s expires on %s", cert.Host, cert.NotAfter.Format(time.RFC3339))
+		}
+	}
+
+	exitCode := 0
+	if *reportPath != "" {
+		if err := run.WriteFile(*reportPath, format); err != nil {
+			log.Printf("failed to write report to %s: %v", *reportPath, err)
+			exitCode = 1
+		}
+	}
+	if *maxFailures >= 0 && summary.Failures() > *maxFailures {
+		log.Printf("%d URLs failed, more than the %d allowed by --max-failures", summary.Failures(), *maxFailures)
+		exitCode = 1
+	}
+	if exitCode != 0 {
+		store.Close()
+		os.Exit(exitCode)
+	}
+
+}
+
+// serveMetrics serves m on /metrics at addr for the lifetime of the process.
+func serveMetrics(addr string, m *metrics.Metrics) {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", m.Handler())
+	log.Printf("Serving metrics on %s", addr)
+	srv := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	if err := srv.ListenAndServe(); err != nil {
+		log.Printf("failed to serve metrics on %s: %v", addr, err)
+	}
+}
+
+// watchTargets schedules entries for watch mode, using the --interval
+// schedule for the ones without their own and skipping invalid schedules.
+func watchTargets(entries []input.Entry, interval string) ([]crawler.Target, error) {
+	defaultSchedule, err := crawler.ParseSchedule(interval)
+	if err != nil {
+		return nil, err
+	}
+
+	targets := make([]crawler.Target, 0, len(entries))
+	for _, e := range entries {
+		schedule := defaultSchedule
+		if e.Schedule != "" {
+			if schedule, err = crawler.ParseSchedule(e.Schedule); err != nil {
+				log.Printf("Invalid schedule for %s on line %d: %v", e.URL, e.Line, err)
+				continue
+			}
+		}
+		targets = append(targets, crawler.Target{URL: e.URL, Schedule: schedule})
+	}
+	return targets, nil
+}
+
+// sitemapURLs returns the canonical URLs of the pages listed in the sitemaps
+// of targets that were not seen yet, without the ones unchanged since they
+// were stored when lastMod is set.
+func sitemapURLs(ctx context.Context, c *crawler.Crawler, targets []string, seen *urlnorm.Seen, lastMod bool) ([]string, error) {
+	var entries []crawler.SitemapEntry
+	for _, target := range targets {
+		if target = strings.TrimSpace(target); target == "" {
+			continue
+		}
+		found, err := c.Sitemap(ctx, target)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read sitemaps of %s: %w", target, err)
+		}
+		log.Printf("Found %d URLs in the sitemaps of %s", len(found), target)
+		for _, e := range found {
+			canonical, isNew, err := seen.Add(e.URL)
+			if err == nil && isNew {
+				e.URL = canonical
+				entries = append(entries, e)
+			}
+		}
+	}
+
+	if !lastMod {
+		var pages []string
+		for _, e := range entries {
+			pages = append(pages, e.URL)
+		}
+		return pages, nil
+	}
+	pages, skipped := c.SkipUnchanged(ctx, entries)
+	if skipped > 0 {
+		log.Printf("Skipping %d sitemap URLs unchanged since they were stored", skipped)
+	}
+	return pages, nil
+}
+
+// canonicalEntries rewrites the URLs of entries into their canonical form and
+// drops the ones already in seen, keeping the first of duplicates.
+func canonicalEntries(entries []input.Entry, seen *urlnorm.Seen) []input.Entry {
+	canonical := entries[:0]
+	duplicates := 0
+	for _, e := range entries {
+		url, isNew, err := seen.Add(e.URL)
+		if err != nil {
+			// Validated when read, so this is not expected
+			log.Printf("Invalid URL on line %d: %v", e.Line, err)
+			continue
+		}
+		if !isNew {
+			duplicates++
+			continue
+		}
+		e.URL = url
+		canonical = append(canonical, e)
+	}
+	if duplicates > 0 {
+		log.Printf("Skipping %d duplicate URLs", duplicates)
+	}
+	return canonical
+}
+
+// defaultWorkerID names this process after its host and PID.
+func defaultWorkerID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "urls"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
+// openStore opens the result store selected with --store. Postgres is
+// configured through the DB_* environment variables and migrated on start.
+func openStore(kind crawler.StoreKind, path string, compression crawler.Compression, workers int) (crawler.ResultStore, error) {
+	switch kind {
+	case crawler.SQLiteStoreKind:
+		if path == "" {
+			path = "urls.db"
+		}
+		return crawler.OpenSQLiteStore(path, compression)
+	case crawler.FileStoreKind:
+		if path == "" {
+			path = "urls-data"
+		}
+		return crawler.OpenFileStore(path, compression)
+	}
 
 	dbUser := config.GetEnv("DB_USER")
 	dbPassword := config.GetEnv("DB_PASS")
@@ -22,53 +473,56 @@ func main() {
 
 	// Create connection string using environment variables
 	dbURL := fmt.Sprintf("user=%s password=%s dbname=%s host=%s port=%s sslmode=disable", dbUser, dbPassword, dbName, dbHost, dbPort)
-	fmt.Println(dbURL)
+	log.Printf("connecting to database %s on %s:%s", dbName, dbHost, dbPort)
 	db, err := sql.Open("postgres", dbURL)
-
 	if err != nil {
-		log.Fatalf("failed to connect to the database: %v", err)
+		return nil, fmt.Errorf("failed to connect to the database: %w", err)
 	}
 
 	// Ensure the database connection is valid
 	if err := db.Ping(); err != nil {
-		log.Fatalf("failed to ping the database: %v", err)
+		db.Close()
+		return nil, fmt.Errorf("failed to ping the database: %w", err)
 	}
 
 	// Run database migrations
 	if err := migrate.Do(db); err != nil {
-		log.Fatalf("failed to setup database: %v", err)
-	}
-
-	urlsFlag := flag.String("urls", "", "Comma-separated list of URLs to fetch")
-	flag.Parse()
-	if urlsFlag == nil || *urlsFlag == "" {
-		fmt.Println("Please provide URLs with the --urls flag.")
-		return
+		db.Close()
+		return nil, fmt.Errorf("failed to setup database: %w", err)
 	}
 
-	// Split the URLs by commas
-	urls := strings.Split(*urlsFlag, ",")
-
-	var successCount, failureCount int
+	// Keep the DB pool in line with the number of workers inserting results
+	db.SetMaxOpenConns(workers)
+	return crawler.NewPostgresStore(db, compression), nil
+}
 
-	var results = make(chan error, len(urls))
+// loadEntries reads the URLs given with --urls and --input, logging the ones
+// that are not valid URLs.
+func loadEntries(urlsFlag, inputFlag, formatFlag string) ([]input.Entry, int, error) {
+	var entries []input.Entry
+	var invalid []error
 
-	for _, url := range urls {
-		go func(url string) {
-			err := crawler.Do(url, db)
-			results <- err
-		}(url)
+	if urlsFlag != "" {
+		entries, invalid = input.FromList(urlsFlag)
+		for _, err := range invalid {
+			log.Printf("Invalid URL in --urls, entry %v", err)
+		}
 	}
 
-	for i := 0; i < len(urls); i++ {
-		err := <-results
+	if inputFlag != "" {
+		format, err := input.ParseFormat(formatFlag)
 		if err != nil {
-			failureCount++
-			log.Printf("Error URL: %v\n", err)
-		} else {
-			successCount++
+			return nil, 0, err
 		}
+		fileEntries, fileInvalid, err := input.ReadFile(inputFlag, format)
+		if err != nil {
+			return nil, 0, err
+		}
+		for _, err := range fileInvalid {
+			log.Printf("Invalid URL in %s, %v", inputFlag, err)
+		}
+		entries = append(entries, fileEntries...)
+		invalid = append(invalid, fileInvalid...)
 	}
-	fmt.Printf("Success count = %d, Failurecount = %d", successCount, failureCount)
-
+	return entries, len(invalid), nil
 }
@@ -0,0 +1,8 @@
+ALTER TABLE url_responses
+  DROP COLUMN IF EXISTS status_code,
+  DROP COLUMN IF EXISTS final_url,
+  DROP COLUMN IF EXISTS headers,
+  DROP COLUMN IF EXISTS content_type,
+  DROP COLUMN IF EXISTS content_length,
+  DROP COLUMN IF EXISTS fetch_duration_ms,
+  DROP COLUMN IF EXISTS fetched_at;
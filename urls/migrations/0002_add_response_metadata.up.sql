@@ -0,0 +1,8 @@
+ALTER TABLE url_responses
+  ADD COLUMN status_code       INTEGER,
+  ADD COLUMN final_url         TEXT,
+  ADD COLUMN headers           JSONB,
+  ADD COLUMN content_type      TEXT,
+  ADD COLUMN content_length    BIGINT,
+  ADD COLUMN fetch_duration_ms INTEGER,
+  ADD COLUMN fetched_at        TIMESTAMPTZ NOT NULL DEFAULT now();
@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS url_responses_url_id_idx;
+
+DELETE FROM url_responses WHERE response IS NULL;
+
+ALTER TABLE url_responses
+  DROP COLUMN IF EXISTS unchanged_from,
+  DROP COLUMN IF EXISTS last_modified,
+  DROP COLUMN IF EXISTS etag,
+  ALTER COLUMN response SET NOT NULL;
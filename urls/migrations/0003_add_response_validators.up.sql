@@ -0,0 +1,7 @@
+ALTER TABLE url_responses
+  ALTER COLUMN response DROP NOT NULL,
+  ADD COLUMN etag           TEXT,
+  ADD COLUMN last_modified  TEXT,
+  ADD COLUMN unchanged_from INTEGER REFERENCES url_responses (id);
+
+CREATE INDEX IF NOT EXISTS url_responses_url_id_idx ON url_responses (url, id DESC);
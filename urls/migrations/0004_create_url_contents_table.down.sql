@@ -0,0 +1,13 @@
+DROP INDEX IF EXISTS url_responses_content_hash_idx;
+
+ALTER TABLE url_responses ADD COLUMN response TEXT;
+
+-- Compressed bodies cannot be decoded in SQL and are lost
+UPDATE url_responses r
+SET response = convert_from(c.data, 'UTF8')
+FROM url_contents c
+WHERE c.hash = r.content_hash AND c.encoding = 'identity';
+
+ALTER TABLE url_responses DROP COLUMN IF EXISTS content_hash;
+
+DROP TABLE IF EXISTS url_contents;
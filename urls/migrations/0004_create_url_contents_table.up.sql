@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS url_contents (
+  hash       TEXT PRIMARY KEY,
+  encoding   TEXT NOT NULL DEFAULT 'identity',
+  size       BIGINT NOT NULL,
+  data       BYTEA NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+ALTER TABLE url_responses ADD COLUMN content_hash TEXT REFERENCES url_contents (hash);
+
+-- Move existing bodies into the content table, storing each distinct one once
+INSERT INTO url_contents (hash, size, data)
+SELECT DISTINCT encode(sha256(convert_to(response, 'UTF8')), 'hex'),
+       octet_length(convert_to(response, 'UTF8')),
+       convert_to(response, 'UTF8')
+FROM url_responses
+WHERE response IS NOT NULL
+ON CONFLICT (hash) DO NOTHING;
+
+UPDATE url_responses
+SET content_hash = encode(sha256(convert_to(response, 'UTF8')), 'hex')
+WHERE response IS NOT NULL;
+
+ALTER TABLE url_responses DROP COLUMN response;
+
+CREATE INDEX IF NOT EXISTS url_responses_content_hash_idx ON url_responses (content_hash);
@@ -0,0 +1,8 @@
+ALTER TABLE url_responses DROP COLUMN IF EXISTS truncated;
+
+DROP TABLE IF EXISTS url_content_chunks;
+
+DELETE FROM url_responses WHERE content_hash IN (SELECT hash FROM url_contents WHERE data IS NULL);
+DELETE FROM url_contents WHERE data IS NULL;
+
+ALTER TABLE url_contents ALTER COLUMN data SET NOT NULL;
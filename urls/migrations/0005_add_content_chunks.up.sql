@@ -0,0 +1,11 @@
+ALTER TABLE url_contents ALTER COLUMN data DROP NOT NULL;
+
+-- Bodies too large to buffer are streamed in chunks; data is NULL for them
+CREATE TABLE IF NOT EXISTS url_content_chunks (
+  hash TEXT    NOT NULL REFERENCES url_contents (hash) ON DELETE CASCADE,
+  seq  INTEGER NOT NULL,
+  data BYTEA   NOT NULL,
+  PRIMARY KEY (hash, seq)
+);
+
+ALTER TABLE url_responses ADD COLUMN truncated BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,3 @@
+ALTER TABLE url_contents
+  DROP COLUMN IF EXISTS text,
+  DROP COLUMN IF EXISTS charset;
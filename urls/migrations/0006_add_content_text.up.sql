@@ -0,0 +1,7 @@
+-- data keeps the raw bytes; text is the body decoded to UTF-8 for textual
+-- content types and NULL otherwise. Existing rows are left NULL, as neither
+-- their content type nor their charset is known here: they are read from
+-- data until the URL is fetched again.
+ALTER TABLE url_contents
+  ADD COLUMN charset TEXT,
+  ADD COLUMN text    TEXT;
@@ -0,0 +1,25 @@
+CREATE TABLE IF NOT EXISTS crawl_jobs (
+  id          SERIAL PRIMARY KEY,
+  status      TEXT NOT NULL DEFAULT 'running',
+  crawl       BOOLEAN NOT NULL DEFAULT false,
+  options     JSONB,
+  created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+  finished_at TIMESTAMPTZ
+);
+
+-- The frontier of a job: every URL it has queued, with its state. The unique
+-- (job_id, url) pair keeps a URL from being queued twice in a job.
+CREATE TABLE IF NOT EXISTS crawl_queue (
+  id         BIGSERIAL PRIMARY KEY,
+  job_id     INTEGER NOT NULL REFERENCES crawl_jobs (id) ON DELETE CASCADE,
+  url        TEXT NOT NULL,
+  depth      INTEGER NOT NULL DEFAULT 0,
+  state      TEXT NOT NULL DEFAULT 'pending'
+             CHECK (state IN ('pending', 'in_progress', 'done', 'failed')),
+  attempts   INTEGER NOT NULL DEFAULT 0,
+  error      TEXT,
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  UNIQUE (job_id, url)
+);
+
+CREATE INDEX IF NOT EXISTS crawl_queue_job_state_idx ON crawl_queue (job_id, state, id);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS crawl_queue_locked_by_idx;
+
+ALTER TABLE crawl_queue
+  DROP COLUMN IF EXISTS lease_until,
+  DROP COLUMN IF EXISTS locked_by;
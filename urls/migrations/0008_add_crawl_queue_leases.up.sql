@@ -0,0 +1,7 @@
+-- Workers claim URLs by setting locked_by and keep them with heartbeats that
+-- push lease_until forward; URLs whose lease ran out can be claimed again.
+ALTER TABLE crawl_queue
+  ADD COLUMN locked_by   TEXT,
+  ADD COLUMN lease_until TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS crawl_queue_locked_by_idx ON crawl_queue (job_id, locked_by) WHERE state = 'in_progress';
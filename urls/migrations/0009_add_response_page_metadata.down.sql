@@ -0,0 +1,12 @@
+DROP INDEX IF EXISTS url_responses_canonical_url_idx;
+
+ALTER TABLE url_responses
+  DROP COLUMN IF EXISTS json_ld,
+  DROP COLUMN IF EXISTS headings,
+  DROP COLUMN IF EXISTS twitter,
+  DROP COLUMN IF EXISTS open_graph,
+  DROP COLUMN IF EXISTS lang,
+  DROP COLUMN IF EXISTS robots,
+  DROP COLUMN IF EXISTS canonical_url,
+  DROP COLUMN IF EXISTS description,
+  DROP COLUMN IF EXISTS title;
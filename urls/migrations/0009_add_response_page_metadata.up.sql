@@ -0,0 +1,14 @@
+-- Parsed from HTML responses; NULL for other content and revalidated
+-- responses, whose metadata is the one of the response they point at
+ALTER TABLE url_responses
+  ADD COLUMN title         TEXT,
+  ADD COLUMN description   TEXT,
+  ADD COLUMN canonical_url TEXT,
+  ADD COLUMN robots        TEXT,
+  ADD COLUMN lang          TEXT,
+  ADD COLUMN open_graph    JSONB,
+  ADD COLUMN twitter       JSONB,
+  ADD COLUMN headings      JSONB,
+  ADD COLUMN json_ld       JSONB;
+
+CREATE INDEX IF NOT EXISTS url_responses_canonical_url_idx ON url_responses (canonical_url);
@@ -0,0 +1,15 @@
+-- Values pulled out of fetched pages by the rules given with --rules. Fields
+-- extracted with "all" have one row per value, numbered by seq.
+CREATE TABLE IF NOT EXISTS extracted_fields (
+  id         BIGSERIAL PRIMARY KEY,
+  job_id     INTEGER REFERENCES crawl_jobs (id) ON DELETE CASCADE,
+  url        TEXT NOT NULL,
+  final_url  TEXT,
+  field      TEXT NOT NULL,
+  seq        INTEGER NOT NULL DEFAULT 0,
+  value      TEXT NOT NULL,
+  fetched_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS extracted_fields_job_field_idx ON extracted_fields (job_id, field);
+CREATE INDEX IF NOT EXISTS extracted_fields_field_url_idx ON extracted_fields (field, url, fetched_at DESC);
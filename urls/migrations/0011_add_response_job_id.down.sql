@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS url_responses_job_id_idx;
+
+ALTER TABLE url_responses
+  DROP COLUMN IF EXISTS job_id;
@@ -0,0 +1,6 @@
+-- The crawl job a response was fetched for, so that the results of a job can
+-- be listed; NULL outside jobs
+ALTER TABLE url_responses
+  ADD COLUMN job_id INTEGER REFERENCES crawl_jobs (id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS url_responses_job_id_idx ON url_responses (job_id, id);
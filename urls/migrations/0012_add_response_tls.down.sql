@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS url_responses_cert_not_after_idx;
+
+ALTER TABLE url_responses
+  DROP COLUMN IF EXISTS cert_not_after,
+  DROP COLUMN IF EXISTS tls;
@@ -0,0 +1,8 @@
+-- The connection of HTTPS responses: TLS version and the certificate chain
+-- of the server, with the earliest expiry of the chain to find certificates
+-- about to expire; NULL for plain HTTP
+ALTER TABLE url_responses
+  ADD COLUMN tls            JSONB,
+  ADD COLUMN cert_not_after TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS url_responses_cert_not_after_idx ON url_responses (cert_not_after);